@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"cmp"
+	"math/bits"
+)
+
+// Number is a constraint of integer and floating point types
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// forEachMasked calls fn with each index of values set in mask,
+// in one pass skipping zero words
+func forEachMasked(mask *BitArray, n int, fn func(i int)) {
+	if mask == nil || n <= 0 {
+		return
+	}
+	last := mask.lastWord()
+	if w := (n - 1) >> 6; w < last {
+		last = w
+	}
+	for w := 0; w <= last; w++ {
+		for v := mask.word(w); v != 0; v &= v - 1 {
+			i := w<<6 + bits.TrailingZeros64(v)
+			if i >= n {
+				return
+			}
+			fn(i)
+		}
+	}
+}
+
+// SumWhere returns sum of values at indices set in mask,
+// bits beyond values are ignored
+func SumWhere[T Number](mask *BitArray, values []T) T {
+	var sum T
+	forEachMasked(mask, len(values), func(i int) {
+		sum += values[i]
+	})
+	return sum
+}
+
+// MaskedMinMax returns minimum and maximum of values at indices set in
+// mask, ok is false when no such value exists
+func MaskedMinMax[T cmp.Ordered](mask *BitArray, values []T) (min, max T, ok bool) {
+	forEachMasked(mask, len(values), func(i int) {
+		v := values[i]
+		if !ok {
+			min, max, ok = v, v, true
+			return
+		}
+		if cmp.Less(v, min) {
+			min = v
+		}
+		if cmp.Less(max, v) {
+			max = v
+		}
+	})
+	return min, max, ok
+}
+
+// FilterSlice returns values of in at indices set in mask, in order,
+// bits beyond in are ignored
+func FilterSlice[T any](mask *BitArray, in []T) []T {
+	if mask == nil {
+		return nil
+	}
+	res := make([]T, 0, mask.CountRange(0, len(in)))
+	forEachMasked(mask, len(in), func(i int) {
+		res = append(res, in[i])
+	})
+	return res
+}
+
+// FilterSliceInto keeps indices: it stores in[i] in dst[i] where bit i of
+// mask is set and the zero value elsewhere, up to the shorter of dst and
+// in, and returns count of values kept
+func FilterSliceInto[T any](dst []T, mask *BitArray, in []T) int {
+	n := len(in)
+	if len(dst) < n {
+		n = len(dst)
+	}
+	clear(dst[:n])
+	var cnt int
+	forEachMasked(mask, n, func(i int) {
+		dst[i] = in[i]
+		cnt++
+	})
+	return cnt
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestSumWhere(t *testing.T) {
+	values := make([]float64, 130)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	mask := New(200, true)
+	for _, i := range []int{1, 64, 129, 150} {
+		mask.Set(i)
+	}
+	if SumWhere(mask, values) != 194 || SumWhere(mask, values[:64]) != 1 || SumWhere(New(10, false), values) != 0 {
+		t.Fatalf("failed on test case 1")
+	}
+	if SumWhere(mask, []uint8{0, 200}) != 200 || SumWhere[int](nil, []int{1}) != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+}
+
+func TestMaskedMinMax(t *testing.T) {
+	mask := New(100, false)
+	if _, _, ok := MaskedMinMax(mask, []int{1, 2}); ok {
+		t.Fatalf("failed on test case 1")
+	}
+	mask.Set(1)
+	mask.Set(3)
+	mask.Set(70)
+	if min, max, ok := MaskedMinMax(mask, []int{-10, 5, 100, -3, 7}); !ok || min != -3 || max != 5 {
+		t.Fatalf("failed on test case 2")
+	}
+	if min, max, ok := MaskedMinMax(mask, []string{"a", "b", "c", "d"}); !ok || min != "b" || max != "d" {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestFilterSlice(t *testing.T) {
+	in := []string{"a", "b", "c", "d", "e"}
+	mask := New(100, true)
+	mask.Set(0)
+	mask.Set(3)
+	mask.Set(50)
+	res := FilterSlice(mask, in)
+	if len(res) != 2 || res[0] != "a" || res[1] != "d" || len(FilterSlice(New(5, false), in)) != 0 {
+		t.Fatalf("failed on test case 1")
+	}
+	dst := []string{"x", "x", "x", "x"}
+	if FilterSliceInto(dst, mask, in) != 2 || dst[0] != "a" || dst[1] != "" || dst[3] != "d" {
+		t.Fatalf("failed on test case 2")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Allocator hands out integer IDs [0, length) tracked in a BitArray, e.g.
+// connection IDs, inode numbers or slots.
+//
+// Searches start at a cursor after the last allocation and wrap around, so
+// freed IDs are not reused right away and allocations do not rescan the
+// busy low IDs. It is safe for concurrent usage.
+type Allocator struct {
+	mu     sync.Mutex
+	used   *BitArray
+	cursor int
+	inUse  int
+}
+
+// NewAllocator returns an instantiated Allocator of IDs [0, length)
+func NewAllocator(length int) *Allocator {
+	return &Allocator{used: New(length, false)}
+}
+
+// Allocate returns a free ID and marks it used, or ErrExhausted
+func (a *Allocator) Allocate() (int, error) {
+	return a.AllocateRange(1)
+}
+
+// AllocateRange returns the first of n consecutive free IDs and marks them
+// used, or ErrExhausted when no such run is free
+func (a *Allocator) AllocateRange(n int) (int, error) {
+	if n < 1 {
+		return 0, fmt.Errorf("%w: range of %d ids", ErrIndexOutOfRange, n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	from := a.used.findClearRun(a.cursor, n)
+	if from < 0 && a.cursor > 0 {
+		from = a.used.findClearRun(0, n)
+	}
+	if from < 0 {
+		return 0, fmt.Errorf("%w: %d of %d ids in use", ErrExhausted, a.inUse, a.used.Len())
+	}
+	a.used.SetRange(from, from+n)
+	a.inUse += n
+	a.cursor = from + n
+	if a.cursor >= a.used.Len() {
+		a.cursor = 0
+	}
+	return from, nil
+}
+
+// Free releases id and reports whether it was allocated
+func (a *Allocator) Free(id int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.used.RemoveChanged(id) {
+		return false
+	}
+	a.inUse--
+	return true
+}
+
+// Allocated reports whether id is in use
+func (a *Allocator) Allocated(id int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.used.Get(id)
+}
+
+// InUse returns the number of allocated IDs
+func (a *Allocator) InUse() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.inUse
+}
+
+// Len returns the number of IDs
+func (a *Allocator) Len() int {
+	return a.used.Len()
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestAllocator(t *testing.T) {
+	a := NewAllocator(10)
+	for want := 0; want < 3; want++ {
+		if id, err := a.Allocate(); err != nil || id != want {
+			t.Fatalf("failed on test case 1")
+		}
+	}
+	// freed ids are reused only after the cursor wraps around
+	if !a.Free(1) || a.Free(1) || a.Allocated(1) {
+		t.Fatalf("failed on test case 2")
+	}
+	if id, _ := a.Allocate(); id != 3 {
+		t.Fatalf("failed on test case 3")
+	}
+	if id, err := a.AllocateRange(4); err != nil || id != 4 || a.InUse() != 7 {
+		t.Fatalf("failed on test case 4")
+	}
+	if _, err := a.AllocateRange(3); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("failed on test case 5")
+	}
+	if id, _ := a.AllocateRange(2); id != 8 {
+		t.Fatalf("failed on test case 6")
+	}
+	if id, _ := a.Allocate(); id != 1 {
+		t.Fatalf("failed on test case 7")
+	}
+	if _, err := a.Allocate(); !errors.Is(err, ErrExhausted) || a.InUse() != 10 {
+		t.Fatalf("failed on test case 8")
+	}
+	if _, err := a.AllocateRange(0); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("failed on test case 9")
+	}
+	if a.Free(10) || a.Free(-1) || a.Len() != 10 {
+		t.Fatalf("failed on test case 10")
+	}
+}
+
+func TestAllocatorConcurrent(t *testing.T) {
+	a := NewAllocator(1 << 12)
+	seen := New(1<<12, true)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id, err := a.Allocate(); err == nil; id, err = a.Allocate() {
+				if !seen.SetChanged(id) {
+					t.Errorf("id %d allocated twice", id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if a.InUse() != 1<<12 || seen.Count() != 1<<12 {
+		t.Fatalf("failed on test case 1")
+	}
+}
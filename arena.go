@@ -0,0 +1,169 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// TenantArena allocates many small bitmaps of tenants from shared slabs.
+//
+// Bitmaps are carved from slabs in power of two size classes of words and
+// released ones are reused by the next allocation of the same class, which
+// keeps a large number of tiny masks from fragmenting the heap. Usage is
+// tracked per tenant and allocations over a quota fail with a QuotaError.
+// Bitmaps of the arena must not grow. It is safe for concurrent usage.
+type TenantArena struct {
+	mu        sync.Mutex
+	slabWords int
+	slab      []uint64 // unused tail of the current slab
+	slabs     int
+	free      map[int][][]uint64 // released blocks by size class
+	quota     int
+	quotas    map[string]int
+	usage     map[string]*TenantUsage
+	blocks    map[*BitArray]arenaBlock
+}
+
+// TenantUsage is the allocation state of a tenant
+type TenantUsage struct {
+	Bitmaps int // live bitmaps
+	Bits    int // bits of live bitmaps
+	Bytes   int // bytes taken by live bitmaps, in size classes
+}
+
+type arenaBlock struct {
+	tenant string
+	words  []uint64
+}
+
+// NewTenantArena returns an instantiated TenantArena with slabs of
+// slabBytes and a default quota of bytes per tenant, 0 is unlimited
+func NewTenantArena(slabBytes, quota int) *TenantArena {
+	slabWords := slabBytes / 8
+	if slabWords < 1 {
+		slabWords = 1
+	}
+	return &TenantArena{
+		slabWords: slabWords,
+		free:      make(map[int][][]uint64),
+		quota:     quota,
+		quotas:    make(map[string]int),
+		usage:     make(map[string]*TenantUsage),
+		blocks:    make(map[*BitArray]arenaBlock),
+	}
+}
+
+// SetQuota sets the quota of tenant in bytes, 0 is unlimited and a
+// negative value restores the default
+func (a *TenantArena) SetQuota(tenant string, bytes int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if bytes < 0 {
+		delete(a.quotas, tenant)
+	} else {
+		a.quotas[tenant] = bytes
+	}
+}
+
+// Alloc returns a cleared BitArray of length bits owned by tenant,
+// or a QuotaError when it would take the tenant over its quota
+func (a *TenantArena) Alloc(tenant string, length int, concurrent bool) (*BitArray, error) {
+	if length < 0 {
+		length = 0
+	}
+	class := arenaClass((length + 63) / 64)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u := a.usage[tenant]
+	if u == nil {
+		u = &TenantUsage{}
+	}
+	quota, ok := a.quotas[tenant]
+	if !ok {
+		quota = a.quota
+	}
+	if quota > 0 && u.Bytes+8*class > quota {
+		return nil, &QuotaError{Tenant: tenant, Used: u.Bytes, Requested: 8 * class, Quota: quota}
+	}
+	words := a.take(class)
+	ba := NewInBuffer(words, length, concurrent)
+	a.blocks[ba] = arenaBlock{tenant, words}
+	u.Bitmaps++
+	u.Bits += length
+	u.Bytes += 8 * class
+	a.usage[tenant] = u
+	return ba, nil
+}
+
+// Release returns memory of a bitmap allocated by Alloc to the arena,
+// BitArray is freed and must not be used after. It returns false when
+// the bitmap does not belong to the arena.
+func (a *TenantArena) Release(ba *BitArray) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.blocks[ba]
+	if !ok {
+		return false
+	}
+	delete(a.blocks, ba)
+	u := a.usage[b.tenant]
+	u.Bitmaps--
+	u.Bits -= ba.Len()
+	u.Bytes -= 8 * len(b.words)
+	if u.Bitmaps == 0 {
+		delete(a.usage, b.tenant)
+	}
+	ba.Free()
+	clear(b.words)
+	if len(b.words) <= a.slabWords {
+		a.free[len(b.words)] = append(a.free[len(b.words)], b.words)
+	}
+	return true
+}
+
+// Usage returns the allocation state of tenant
+func (a *TenantArena) Usage(tenant string) TenantUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if u := a.usage[tenant]; u != nil {
+		return *u
+	}
+	return TenantUsage{}
+}
+
+// SlabBytes returns bytes of slabs taken from the heap
+func (a *TenantArena) SlabBytes() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return 8 * a.slabs * a.slabWords
+}
+
+// take returns a cleared block of class words, reusing released ones,
+// blocks larger than a slab are allocated on their own
+func (a *TenantArena) take(class int) []uint64 {
+	if l := a.free[class]; len(l) > 0 {
+		words := l[len(l)-1]
+		a.free[class] = l[:len(l)-1]
+		return words
+	}
+	if class > a.slabWords {
+		return make([]uint64, class)
+	}
+	if len(a.slab) < class {
+		a.slab = make([]uint64, a.slabWords)
+		a.slabs++
+	}
+	words := a.slab[:class:class]
+	a.slab = a.slab[class:]
+	return words
+}
+
+// arenaClass rounds words up to a power of two
+func arenaClass(words int) int {
+	if words <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(words-1))
+}
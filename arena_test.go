@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTenantArena(t *testing.T) {
+	a := NewTenantArena(1024, 64)
+
+	x, err := a.Alloc("x", 100, false)
+	if err != nil || x.Len() != 100 || x.Count() != 0 {
+		t.Fatalf("failed on test case 1")
+	}
+	x.Set(99)
+	y, _ := a.Alloc("x", 10, true)
+	y.Set(3)
+	if !x.Get(99) || x.Get(3) || !y.Get(3) || y.Get(99%10) {
+		t.Fatalf("failed on test case 2")
+	}
+	if u := a.Usage("x"); u.Bitmaps != 2 || u.Bits != 110 || u.Bytes != 24 {
+		t.Fatalf("failed on test case 3")
+	}
+
+	_, err = a.Alloc("x", 300, false)
+	var qe *QuotaError
+	if !errors.Is(err, ErrQuotaExceeded) || !errors.As(err, &qe) ||
+		qe.Tenant != "x" || qe.Used != 24 || qe.Requested != 64 || qe.Quota != 64 {
+		t.Fatalf("failed on test case 4")
+	}
+	a.SetQuota("x", 0)
+	if _, err = a.Alloc("x", 300, false); err != nil {
+		t.Fatalf("failed on test case 5")
+	}
+	a.SetQuota("x", -1)
+	if _, err = a.Alloc("x", 64, false); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("failed on test case 6")
+	}
+
+	// released blocks are cleared and reused
+	if !a.Release(x) || a.Release(x) || a.Release(New(10, false)) || x.Len() != 0 {
+		t.Fatalf("failed on test case 7")
+	}
+	z, _ := a.Alloc("z", 128, false)
+	if z.Count() != 0 || a.Usage("z").Bytes != 16 || a.Usage("x").Bitmaps != 2 {
+		t.Fatalf("failed on test case 8")
+	}
+	if a.SlabBytes() != 1024 {
+		t.Fatalf("failed on test case 9")
+	}
+
+	// blocks larger than a slab are allocated on their own
+	a.SetQuota("big", 0)
+	big, err := a.Alloc("big", 1<<16, false)
+	if err != nil || a.SlabBytes() != 1024 {
+		t.Fatalf("failed on test case 10")
+	}
+	big.SetAll()
+	if big.Count() != 1<<16 || z.Count() != 0 || !a.Release(big) || a.Usage("big").Bytes != 0 {
+		t.Fatalf("failed on test case 11")
+	}
+}
+
+func TestTenantArenaMany(t *testing.T) {
+	a := NewTenantArena(1<<16, 0)
+	var bas []*BitArray
+	for i := 0; i < 10000; i++ {
+		ba, _ := a.Alloc("t", 64, false)
+		ba.Set(i % 64)
+		bas = append(bas, ba)
+	}
+	if a.SlabBytes() != 2<<16 {
+		t.Fatalf("failed on test case 1")
+	}
+	for i, ba := range bas {
+		if ba.Count() != 1 || !ba.Get(i%64) {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// Batch collects writes of bits to apply them together, see Update
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	index int
+	set   bool
+}
+
+// Set sets bit at index when the batch is applied
+func (b *Batch) Set(index int) {
+	b.ops = append(b.ops, batchOp{index, true})
+}
+
+// Remove removes bit at index when the batch is applied
+func (b *Batch) Remove(index int) {
+	b.ops = append(b.ops, batchOp{index, false})
+}
+
+// Len returns count of collected writes
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Update collects writes of fn in a Batch and applies them together after
+// fn returns.
+//
+// Writes are grouped by word and each word is changed by a single
+// read-modify-write, atomically in concurrent mode, which costs much less
+// than a Set per bit. Batches on the same BitArray are applied one at a
+// time and CountConsistent and CloneConsistent see either none or all
+// writes of a batch. Indices out of range are ignored, the last write of
+// a bit wins.
+func (s *BitArray) Update(fn func(b *Batch)) {
+	var b Batch
+	fn(&b)
+	s.applyBatch(b.ops)
+}
+
+// SetMany sets bits at indices grouped by word, like Update with a Set of
+// each index. Indices out of range are ignored.
+func (s *BitArray) SetMany(indices []int) {
+	s.applyBatch(batchOps(indices, true))
+}
+
+// RemoveMany removes bits at indices grouped by word, like Update with a
+// Remove of each index. Indices out of range are ignored.
+func (s *BitArray) RemoveMany(indices []int) {
+	s.applyBatch(batchOps(indices, false))
+}
+
+func batchOps(indices []int, set bool) []batchOp {
+	ops := make([]batchOp, len(indices))
+	for i, index := range indices {
+		ops[i] = batchOp{index, set}
+	}
+	return ops
+}
+
+// applyBatch applies ops in order, it reorders ops
+func (s *BitArray) applyBatch(ops []batchOp) {
+	if s == nil {
+		return
+	}
+	n, k := s.Len(), 0
+	for _, op := range ops {
+		if op.index >= 0 && op.index < n {
+			ops[k] = op
+			k++
+		}
+	}
+	ops = ops[:k]
+	if len(ops) == 0 {
+		return
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].index>>6 < ops[j].index>>6 })
+
+	s.batch.Lock()
+	defer s.batch.Unlock()
+	lo, hi := int64(ops[0].index>>6), int64(ops[len(ops)-1].index>>6)
+	setLo, setHi := int64(-1), int64(-1)
+	s.writing(lo, hi)
+	for len(ops) > 0 {
+		i := ops[0].index >> 6
+		var set, clr uint64
+		for len(ops) > 0 && ops[0].index>>6 == i {
+			mask := uint64(1) << (ops[0].index & 0x3f)
+			if ops[0].set {
+				set, clr = set|mask, clr&^mask
+			} else {
+				set, clr = set&^mask, clr|mask
+			}
+			ops = ops[1:]
+		}
+		if s.concurrent {
+			for {
+				old := atomic.LoadUint64(&s.data[i])
+				if old&^clr|set == old || atomic.CompareAndSwapUint64(&s.data[i], old, old&^clr|set) {
+					break
+				}
+			}
+		} else {
+			s.data[i] = s.data[i]&^clr | set
+		}
+		if set != 0 {
+			if setLo < 0 {
+				setLo = int64(i)
+			}
+			setHi = int64(i)
+		}
+	}
+	if setLo >= 0 {
+		if s.concurrent {
+			s.growBoundsAtomically(setLo)
+			s.growBoundsAtomically(setHi)
+		} else {
+			if s.left > setLo {
+				s.left = setLo
+			}
+			if s.right < setHi {
+				s.right = setHi
+			}
+		}
+	}
+	s.wrote(lo, hi)
+}
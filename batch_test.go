@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBitArrayUpdate(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		ba.Set(1)
+		ba.Set(64)
+		ba.Update(func(b *Batch) {
+			b.Set(900)
+			b.Set(3)
+			b.Remove(64)
+			b.Set(65)
+			b.Set(-1)
+			b.Set(1000)
+			// the last write wins
+			b.Set(500)
+			b.Remove(500)
+			b.Remove(501)
+			b.Set(501)
+			if b.Len() != 10 {
+				t.Fatalf("failed on test case 1")
+			}
+		})
+		want := []int{1, 3, 65, 501, 900}
+		got := ba.Indices()
+		if len(got) != len(want) {
+			t.Fatalf("failed on test case 2")
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("failed on test case 2")
+			}
+		}
+		if max, _ := ba.MaxSet(); max != 900 {
+			t.Fatalf("failed on test case 3")
+		}
+		ba.Update(func(b *Batch) {})
+		if ba.Count() != 5 || ba.writesBegun.Load() != ba.writesDone.Load() {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestBitArrayUpdateConcurrent(t *testing.T) {
+	// a batch is seen either whole or not at all
+	const n = 1 << 12
+	ba := New(n, true)
+	ba.TrackConsistency()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			ba.Update(func(b *Batch) {
+				for j := 0; j < n; j += 3 {
+					b.Set(j)
+				}
+			})
+			ba.Update(func(b *Batch) {
+				for j := 0; j < n; j += 3 {
+					b.Remove(j)
+				}
+			})
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if c := ba.CountConsistent(); c != 0 && c != (n+2)/3 {
+			t.Fatalf("failed on test case 1")
+		}
+	}
+	wg.Wait()
+}
+
+func TestBitArraySetManyRemoveMany(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(500, concurrent)
+		indices := []int{499, 7, 130, 7, 64, -3, 500}
+		ba.SetMany(indices)
+		if ba.Count() != 4 || !ba.Get(499) || !ba.Get(64) || indices[0] != 499 {
+			t.Fatalf("failed on test case 1")
+		}
+		ba.RemoveMany([]int{130, 499, 8})
+		if ba.Count() != 2 || !ba.Get(7) || !ba.Get(64) {
+			t.Fatalf("failed on test case 2")
+		}
+		ba.SetMany(nil)
+		ba.RemoveMany(nil)
+		if ba.Count() != 2 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+}
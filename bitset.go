@@ -0,0 +1,261 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "sync/atomic"
+
+// BitSet adapts BitArray to the method set of bitset.BitSet from
+// github.com/bits-and-blooms/bitset, so code written against that API can
+// run on goba, in concurrent mode too.
+//
+// Like bitset.BitSet it grows on writes past the end, except in concurrent
+// mode where growing is not safe and such writes are ignored. Convert with
+// bitset.From(b.Words()) and NewBitSetFrom(bs.Words(), concurrent).
+type BitSet struct {
+	ba *BitArray
+}
+
+// NewBitSet returns a BitSet of length bits
+func NewBitSet(length uint, concurrent bool) *BitSet {
+	return &BitSet{ba: New(int(length), concurrent)}
+}
+
+// NewBitSetFrom returns a BitSet of 64 bits per word holding a copy of words
+func NewBitSetFrom(words []uint64, concurrent bool) *BitSet {
+	ba := New(len(words)*64, concurrent)
+	copy(ba.data, words)
+	for i := len(words) - 1; i > 0; i-- {
+		if words[i] != 0 {
+			ba.right = int64(i)
+			break
+		}
+	}
+	return &BitSet{ba: ba}
+}
+
+// AsBitSet returns a BitSet backed by ba, changes of either are shared
+func (s *BitArray) AsBitSet() *BitSet {
+	return &BitSet{ba: s}
+}
+
+// BitArray returns the BitArray backing BitSet
+func (b *BitSet) BitArray() *BitArray {
+	return b.ba
+}
+
+// Words returns a copy of the underlying words
+func (b *BitSet) Words() []uint64 {
+	res := make([]uint64, len(b.ba.data))
+	for i := range res {
+		res[i] = b.ba.word(i)
+	}
+	return res
+}
+
+// extend grows BitSet to hold bit i, it reports false when i stays out of
+// range, in concurrent mode
+func (b *BitSet) extend(i uint) bool {
+	if int(i) < b.ba.Len() {
+		return true
+	}
+	if b.ba.concurrent || i >= uint(maxInt) {
+		return false
+	}
+	b.ba.grow(int(i) + 1)
+	return true
+}
+
+// Len returns length in bits
+func (b *BitSet) Len() uint {
+	return uint(b.ba.Len())
+}
+
+// Test returns whether bit i is set, false past the end
+func (b *BitSet) Test(i uint) bool {
+	if i >= uint(b.ba.Len()) {
+		return false
+	}
+	return b.ba.Get(int(i))
+}
+
+// Set sets bit i
+func (b *BitSet) Set(i uint) *BitSet {
+	if b.extend(i) {
+		b.ba.Set(int(i))
+	}
+	return b
+}
+
+// Clear clears bit i
+func (b *BitSet) Clear(i uint) *BitSet {
+	if i < uint(b.ba.Len()) {
+		b.ba.Remove(int(i))
+	}
+	return b
+}
+
+// SetTo sets bit i to value
+func (b *BitSet) SetTo(i uint, value bool) *BitSet {
+	if value {
+		return b.Set(i)
+	}
+	return b.Clear(i)
+}
+
+// Flip inverts bit i
+func (b *BitSet) Flip(i uint) *BitSet {
+	if !b.extend(i) {
+		return b
+	}
+	s := b.ba
+	w := int64(i >> 6)
+	mask := uint64(1) << (i & 0x3f)
+	s.writing(w, w)
+	if s.concurrent {
+		for {
+			old := atomic.LoadUint64(&s.data[w])
+			if atomic.CompareAndSwapUint64(&s.data[w], old, old^mask) {
+				break
+			}
+		}
+		s.growBoundsAtomically(w)
+	} else {
+		s.data[w] ^= mask
+		if s.right < w {
+			s.right = w
+		}
+	}
+	s.wrote(w, w)
+	return b
+}
+
+// ClearAll clears all bits
+func (b *BitSet) ClearAll() *BitSet {
+	b.ba.RemoveAll()
+	return b
+}
+
+// Count returns count of set bits
+func (b *BitSet) Count() uint {
+	return uint(b.ba.Count())
+}
+
+// Any reports whether any bit is set
+func (b *BitSet) Any() bool {
+	return b.ba.nextSet(0) >= 0
+}
+
+// None reports whether no bit is set
+func (b *BitSet) None() bool {
+	return !b.Any()
+}
+
+// All reports whether all bits are set
+func (b *BitSet) All() bool {
+	return b.ba.nextClear(0) < 0
+}
+
+// NextSet returns the first set bit at or after i, ok is false if none
+func (b *BitSet) NextSet(i uint) (uint, bool) {
+	if i >= uint(b.ba.Len()) {
+		return 0, false
+	}
+	if n := b.ba.nextSet(int(i)); n >= 0 {
+		return uint(n), true
+	}
+	return 0, false
+}
+
+// NextClear returns the first clear bit at or after i, ok is false if none
+func (b *BitSet) NextClear(i uint) (uint, bool) {
+	if i >= uint(b.ba.Len()) {
+		return 0, false
+	}
+	if n := b.ba.nextClear(int(i)); n >= 0 {
+		return uint(n), true
+	}
+	return 0, false
+}
+
+// Clone returns a copy of BitSet
+func (b *BitSet) Clone() *BitSet {
+	return &BitSet{ba: b.ba.Clone()}
+}
+
+// Equal reports whether both BitSets have the same length and bits
+func (b *BitSet) Equal(c *BitSet) bool {
+	return c != nil && b.ba.Equal(c.ba)
+}
+
+// growTo grows BitSet to the length of c, as bitset.BitSet does for
+// in-place unions
+func (b *BitSet) growTo(c *BitSet) {
+	if n := c.ba.Len(); n > b.ba.Len() && !b.ba.concurrent {
+		b.ba.grow(n)
+	}
+}
+
+// InPlaceUnion sets bits of c in BitSet
+func (b *BitSet) InPlaceUnion(c *BitSet) {
+	b.growTo(c)
+	b.ba.combineFrom(c.ba, func(x, y uint64) uint64 { return x | y })
+}
+
+// InPlaceIntersection clears bits not set in c
+func (b *BitSet) InPlaceIntersection(c *BitSet) {
+	b.ba.combineFrom(c.ba, func(x, y uint64) uint64 { return x & y })
+}
+
+// InPlaceDifference clears bits set in c
+func (b *BitSet) InPlaceDifference(c *BitSet) {
+	b.ba.combineFrom(c.ba, func(x, y uint64) uint64 { return x &^ y })
+}
+
+// InPlaceSymmetricDifference inverts bits set in c
+func (b *BitSet) InPlaceSymmetricDifference(c *BitSet) {
+	b.growTo(c)
+	b.ba.combineFrom(c.ba, func(x, y uint64) uint64 { return x ^ y })
+}
+
+// Union returns a new BitSet of bits set in either
+func (b *BitSet) Union(c *BitSet) *BitSet {
+	return b.combined(c, true, func(x, y uint64) uint64 { return x | y })
+}
+
+// Intersection returns a new BitSet of bits set in both
+func (b *BitSet) Intersection(c *BitSet) *BitSet {
+	return b.combined(c, false, func(x, y uint64) uint64 { return x & y })
+}
+
+// Difference returns a new BitSet of bits set in BitSet but not in c
+func (b *BitSet) Difference(c *BitSet) *BitSet {
+	return b.combined(c, false, func(x, y uint64) uint64 { return x &^ y })
+}
+
+// SymmetricDifference returns a new BitSet of bits set in exactly one
+func (b *BitSet) SymmetricDifference(c *BitSet) *BitSet {
+	return b.combined(c, true, func(x, y uint64) uint64 { return x ^ y })
+}
+
+// combined returns a new BitSet of op of both, as long as the longer
+// of both when grow is set
+func (b *BitSet) combined(c *BitSet, grow bool, op func(x, y uint64) uint64) *BitSet {
+	n := b.ba.Len()
+	if grow && c.ba.Len() > n {
+		n = c.ba.Len()
+	}
+	res := New(n, b.ba.concurrent)
+	res.combineFrom(b.ba, func(_, y uint64) uint64 { return y })
+	res.combineFrom(c.ba, op)
+	return &BitSet{ba: res}
+}
+
+// UnionCardinality returns count of bits set in either
+func (b *BitSet) UnionCardinality(c *BitSet) uint {
+	return uint(b.ba.CountOr(c.ba))
+}
+
+// IntersectionCardinality returns count of bits set in both
+func (b *BitSet) IntersectionCardinality(c *BitSet) uint {
+	return uint(b.ba.CountAnd(c.ba))
+}
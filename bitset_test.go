@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestBitSet(t *testing.T) {
+	b := NewBitSet(10, false)
+	b.Set(3).Set(100).Flip(5).Flip(5).Flip(7)
+	if b.Len() != 101 || !b.Test(100) || !b.Test(3) || b.Test(5) || !b.Test(7) || b.Count() != 3 {
+		t.Fatalf("failed on test case 1")
+	}
+	if i, ok := b.NextSet(8); !ok || i != 100 {
+		t.Fatalf("failed on test case 2")
+	}
+	if i, ok := b.NextClear(3); !ok || i != 4 {
+		t.Fatalf("failed on test case 3")
+	}
+	if _, ok := b.NextSet(101); ok || b.Test(1000) {
+		t.Fatalf("failed on test case 4")
+	}
+	c := NewBitSet(200, true)
+	c.Set(3).Set(150).Set(500)
+	if c.Len() != 200 || c.Count() != 2 {
+		t.Fatalf("failed on test case 5")
+	}
+	if b.UnionCardinality(c) != 4 || b.IntersectionCardinality(c) != 1 {
+		t.Fatalf("failed on test case 6")
+	}
+	u := b.Union(c)
+	if u.Len() != 200 || u.Count() != 4 || b.Intersection(c).Count() != 1 ||
+		b.Difference(c).Count() != 2 || b.SymmetricDifference(c).Count() != 3 {
+		t.Fatalf("failed on test case 7")
+	}
+	b.InPlaceUnion(c)
+	if !b.Equal(u) || b.Len() != 200 {
+		t.Fatalf("failed on test case 8")
+	}
+	b.InPlaceDifference(c)
+	b.InPlaceSymmetricDifference(NewBitSetFrom([]uint64{1}, false))
+	if b.Count() != 3 || !b.Test(0) || b.Test(3) {
+		t.Fatalf("failed on test case 9")
+	}
+	b.InPlaceIntersection(NewBitSetFrom([]uint64{0x81}, false))
+	if b.Count() != 2 || !b.Test(7) {
+		t.Fatalf("failed on test case 10")
+	}
+	// converters round trip through words
+	d := NewBitSetFrom(b.Words(), true)
+	if d.Len() != 256 || d.Count() != 2 || d.Words()[0] != 0x81 {
+		t.Fatalf("failed on test case 11")
+	}
+	if !NewBitSet(3, false).Set(0).Set(1).Set(2).All() || !NewBitSet(3, true).None() || b.None() {
+		t.Fatalf("failed on test case 12")
+	}
+	ba := New(64, false)
+	ba.AsBitSet().Set(9)
+	if !ba.Get(9) || ba.AsBitSet().BitArray() != ba || b.ClearAll().Any() {
+		t.Fatalf("failed on test case 13")
+	}
+}
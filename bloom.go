@@ -0,0 +1,127 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Bloom is a Bloom filter backed by BitArray
+type Bloom struct {
+	bits *BitArray
+	m    uint64 // length in bits
+	k    uint64 // number of hash functions
+}
+
+// NewBloom returns an instantiated Bloom filter of m bits and k hash
+// functions.
+//
+// concurrent for concurrent safe usage
+func NewBloom(m uint64, k uint, concurrent bool) *Bloom {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &Bloom{
+		bits: New(int(m), concurrent),
+		m:    m,
+		k:    uint64(k),
+	}
+}
+
+// NewBloomForNP returns an instantiated Bloom filter sized for n elements
+// with false positive rate p, which is clamped to [1e-15, 0.999].
+//
+// m = ceil(-n ln(p) / ln(2)^2) bits and k = round(m/n ln(2)) hash
+// functions minimize the size of the filter for the rate.
+func NewBloomForNP(n uint64, p float64, concurrent bool) *Bloom {
+	m, k := bloomMK(n, p)
+	return NewBloom(m, k, concurrent)
+}
+
+// bloomMK returns optimal length and number of hash functions
+// of a Bloom filter for n elements and false positive rate p
+func bloomMK(n uint64, p float64) (uint64, uint) {
+	if n == 0 {
+		n = 1
+	}
+	if !(p >= 1e-15) {
+		p = 1e-15
+	} else if p > 0.999 {
+		p = 0.999
+	}
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return uint64(m), uint(k)
+}
+
+// M returns length of the filter in bits
+func (b *Bloom) M() uint64 {
+	return b.m
+}
+
+// K returns number of hash functions
+func (b *Bloom) K() uint {
+	return uint(b.k)
+}
+
+// Add data to the filter
+func (b *Bloom) Add(data []byte) {
+	h1, h2 := bloomHashes(data)
+	for i := uint64(0); i < b.k; i++ {
+		idx, _ := bits.Mul64(h1+i*h2, b.m)
+		b.bits.Set(int(idx))
+	}
+}
+
+// Test reports whether data may have been added,
+// false means it definitely was not
+func (b *Bloom) Test(data []byte) bool {
+	h1, h2 := bloomHashes(data)
+	for i := uint64(0); i < b.k; i++ {
+		idx, _ := bits.Mul64(h1+i*h2, b.m)
+		if !b.bits.Get(int(idx)) {
+			return false
+		}
+	}
+	return true
+}
+
+// EstimatedFalsePositiveRate returns false positive rate given current
+// fill of the filter, (set bits / m)^k
+func (b *Bloom) EstimatedFalsePositiveRate() float64 {
+	return math.Pow(float64(b.bits.Count())/float64(b.m), float64(b.k))
+}
+
+// bloomHashes returns two hashes of data for double hashing,
+// the second one is odd
+func bloomHashes(data []byte) (uint64, uint64) {
+	h := hash64(data)
+	return h, mix64(h) | 1
+}
+
+// hash64 is 64-bit FNV-1a
+func hash64(data []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range data {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// mix64 is the splitmix64 finalizer
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
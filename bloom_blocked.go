@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Bits per block of BlockedBloom, one 64-byte cache line
+const bloomBlock = 512
+
+// BlockedBloom is a cache-line blocked Bloom filter, all k probes of an
+// element land in a single 512-bit block. Add and Test touch one cache
+// line instead of k, at the cost of a slightly higher false positive rate
+// than Bloom of the same size.
+type BlockedBloom struct {
+	bits   *BitArray
+	blocks uint64
+	k      uint64
+}
+
+// NewBlockedBloom returns an instantiated BlockedBloom filter of at least
+// m bits, rounded up to whole blocks, and k hash functions.
+//
+// concurrent for concurrent safe usage
+func NewBlockedBloom(m uint64, k uint, concurrent bool) *BlockedBloom {
+	blocks := (m + bloomBlock - 1) / bloomBlock
+	if blocks == 0 {
+		blocks = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &BlockedBloom{
+		bits:   New(int(blocks*bloomBlock), concurrent),
+		blocks: blocks,
+		k:      uint64(k),
+	}
+}
+
+// NewBlockedBloomForNP returns an instantiated BlockedBloom filter sized for
+// n elements with false positive rate p, which is clamped to [1e-15, 0.999].
+//
+// The size starts from the optimum of a classic Bloom filter and grows
+// until the rate of the blocked layout meets p.
+func NewBlockedBloomForNP(n uint64, p float64, concurrent bool) *BlockedBloom {
+	if n == 0 {
+		n = 1
+	}
+	if !(p >= 1e-15) {
+		p = 1e-15
+	} else if p > 0.999 {
+		p = 0.999
+	}
+	m, _ := bloomMK(n, p)
+	for {
+		// more probes than suit a single element only fill its block
+		k := uint(math.Round(float64(m) / float64(n) * math.Ln2))
+		if k < 1 {
+			k = 1
+		} else if k > maxBlockedK {
+			k = maxBlockedK
+		}
+		// a block per 64 elements meets any p of the clamped range
+		next := m + m/32 + bloomBlock
+		if blockedFPR(n, m, k) <= p || next/bloomBlock/64 > n || next < m {
+			return NewBlockedBloom(m, k, concurrent)
+		}
+		m = next
+	}
+}
+
+// maxBlockedK is the optimal number of probes for one element in a block,
+// bloomBlock·ln2
+const maxBlockedK = 354
+
+// blockedFPR returns false positive rate of a blocked filter with n
+// elements, m bits and k hash functions. Loads of blocks are Poisson
+// distributed, the rate is the expectation of the rate of a block.
+func blockedFPR(n, m uint64, k uint) float64 {
+	blocks := (m + bloomBlock - 1) / bloomBlock
+	lambda := float64(n) / float64(blocks)
+	limit := int(lambda + 10*math.Sqrt(lambda) + 20)
+	var res float64
+	for i := 0; i <= limit; i++ {
+		logp := float64(i)*math.Log(lambda) - lambda
+		lg, _ := math.Lgamma(float64(i + 1))
+		fill := 1 - math.Pow(1-1.0/bloomBlock, float64(i)*float64(k))
+		res += math.Exp(logp-lg) * math.Pow(fill, float64(k))
+	}
+	return res
+}
+
+// M returns length of the filter in bits
+func (b *BlockedBloom) M() uint64 {
+	return b.blocks * bloomBlock
+}
+
+// K returns number of hash functions
+func (b *BlockedBloom) K() uint {
+	return uint(b.k)
+}
+
+// Add data to the filter
+func (b *BlockedBloom) Add(data []byte) {
+	base, h1, h2 := b.hashes(data)
+	for i := uint64(0); i < b.k; i++ {
+		b.bits.Set(base + int((h1+i*h2)>>55))
+	}
+}
+
+// Test reports whether data may have been added,
+// false means it definitely was not
+func (b *BlockedBloom) Test(data []byte) bool {
+	base, h1, h2 := b.hashes(data)
+	for i := uint64(0); i < b.k; i++ {
+		if !b.bits.Get(base + int((h1+i*h2)>>55)) {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes returns first bit of the block of data and two hashes
+// for probes within the block
+func (b *BlockedBloom) hashes(data []byte) (int, uint64, uint64) {
+	h := mix64(hash64(data))
+	block, _ := bits.Mul64(h, b.blocks)
+	h1 := mix64(h)
+	return int(block) * bloomBlock, h1, mix64(h1) | 1
+}
+
+// EstimatedFalsePositiveRate returns false positive rate given current
+// fill of the filter, the mean of (set bits / 512)^k over blocks
+func (b *BlockedBloom) EstimatedFalsePositiveRate() float64 {
+	var res float64
+	for i := 0; i < int(b.blocks); i++ {
+		fill := float64(b.bits.CountRange(i*bloomBlock, (i+1)*bloomBlock)) / bloomBlock
+		res += math.Pow(fill, float64(b.k))
+	}
+	return res / float64(b.blocks)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestBlockedBloomForNP(t *testing.T) {
+	b := NewBlockedBloomForNP(10000, 0.01, true)
+	classic := NewBloomForNP(10000, 0.01, false)
+
+	t.Log(b.M(), b.K(), classic.M())
+	if b.M()%512 != 0 || b.M() < classic.M() {
+		t.Fatalf("failed on test case 1")
+	}
+
+	for i := 0; i < 10000; i++ {
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 10000; i++ {
+		if !b.Test([]byte(strconv.Itoa(i))) {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+
+	var fp int
+	for i := 10000; i < 110000; i++ {
+		if b.Test([]byte(strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	est := b.EstimatedFalsePositiveRate()
+	t.Log(fp, est)
+	if fp > 1500 || est > 0.015 {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBlockedBloomSmall(t *testing.T) {
+	b := NewBlockedBloom(1, 0, false)
+	if b.M() != 512 || b.K() != 1 {
+		t.Fatalf("failed on test case 1")
+	}
+	b.Add([]byte("a"))
+	if !b.Test([]byte("a")) || b.bits.Count() != 1 {
+		t.Fatalf("failed on test case 2")
+	}
+}
+
+func TestBlockedBloomForTinyP(t *testing.T) {
+	for i, p := range []float64{1e-9, 1e-12, 1e-15, 1e-30, 0, math.NaN()} {
+		b := NewBlockedBloomForNP(1000, p, false)
+		if !(p >= 1e-15) {
+			p = 1e-15
+		}
+		if b.K() > maxBlockedK || blockedFPR(1000, b.M(), b.K()) > p {
+			t.Fatalf("failed on test case %d", i+1)
+		}
+	}
+	if b := NewBlockedBloomForNP(1000, math.NaN(), false); b.M() != NewBlockedBloomForNP(1000, 1e-15, false).M() {
+		t.Fatalf("failed on test case 7")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloomForNP(t *testing.T) {
+	b := NewBloomForNP(10000, 0.01, false)
+
+	// 9.59 bits per element and 7 hash functions for 1%
+	if b.M() != 95851 || b.K() != 7 {
+		t.Fatalf("failed on test case 1: %d %d", b.M(), b.K())
+	}
+	if b.EstimatedFalsePositiveRate() != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+
+	for i := 0; i < 10000; i++ {
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 10000; i++ {
+		if !b.Test([]byte(strconv.Itoa(i))) {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+
+	var fp int
+	for i := 10000; i < 110000; i++ {
+		if b.Test([]byte(strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	est := b.EstimatedFalsePositiveRate()
+	t.Log(fp, est)
+	if fp > 1500 || est < 0.005 || est > 0.015 {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestBloomConcurrent(t *testing.T) {
+	b := NewBloom(0, 0, true)
+	b.Add([]byte("a"))
+	if !b.Test([]byte("a")) || b.M() != 1 || b.K() != 1 {
+		t.Fatalf("failed on test case 1")
+	}
+
+	b = NewBloomForNP(0, 0, true)
+	if b.M() == 0 || b.K() == 0 {
+		t.Fatalf("failed on test case 2")
+	}
+}
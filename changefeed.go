@@ -0,0 +1,188 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// MutationKind tells how Mutation is applied
+type MutationKind uint8
+
+const (
+	// Words replace data words starting at Offset
+	MutationWords MutationKind = iota + 1
+	// Full replaces the whole state, Length and all data words
+	MutationFull
+)
+
+// Mutation is an entry of Changefeed.
+//
+// It carries word values after the change rather than the operation, so
+// applying mutations in Seq order converges to the state of the source
+// even when writers race in concurrent mode.
+type Mutation struct {
+	Seq    uint64 // sequence number, starting from 1
+	Kind   MutationKind
+	Length int      // length in bits, for MutationFull
+	Offset int      // index of the first word, for MutationWords
+	Words  []uint64 // word values
+}
+
+// Changefeed is an ordered, sequence numbered stream of mutations
+// of BitArray, for replicating it to followers
+type Changefeed struct {
+	mu        sync.Mutex
+	ba        *BitArray
+	seq       uint64
+	log       []Mutation
+	capacity  int
+	fullEvery int
+	sinceFull int
+	notify    chan struct{}
+}
+
+// StartChangefeed attaches a changefeed to BitArray. It retains at least
+// the last capacity mutations and appends a full state marker after every
+// fullEvery mutations, zero disables the markers.
+//
+// Not safe for concurrent usage, set it up before sharing BitArray
+func (s *BitArray) StartChangefeed(capacity, fullEvery int) *Changefeed {
+	if capacity < 1 {
+		capacity = 1
+	}
+	f := &Changefeed{
+		ba:        s,
+		capacity:  capacity,
+		fullEvery: fullEvery,
+		notify:    make(chan struct{}),
+	}
+	s.feed = f
+	return f
+}
+
+// StopChangefeed detaches the changefeed from BitArray.
+//
+// Not safe for concurrent usage
+func (s *BitArray) StopChangefeed() {
+	s.feed = nil
+}
+
+// record appends words [lo, hi] of BitArray to the feed
+func (f *Changefeed) record(lo, hi int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// loading words under the lock after the change makes
+	// the last record of every word hold its latest value
+	if lo == 0 && int(hi) == len(f.ba.data)-1 {
+		f.append(f.full(f.seq + 1))
+	} else {
+		words := make([]uint64, hi-lo+1)
+		for i := range words {
+			words[i] = f.ba.word(int(lo) + i)
+		}
+		f.append(Mutation{Seq: f.seq + 1, Kind: MutationWords, Offset: int(lo), Words: words})
+	}
+	if f.fullEvery > 0 && f.sinceFull >= f.fullEvery {
+		f.append(f.full(f.seq + 1))
+	}
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+func (f *Changefeed) append(m Mutation) {
+	f.seq = m.Seq
+	if m.Kind == MutationFull {
+		f.sinceFull = 0
+	} else {
+		f.sinceFull++
+	}
+	if len(f.log) >= 2*f.capacity {
+		f.log = append(f.log[:0:0], f.log[len(f.log)-f.capacity:]...)
+	}
+	f.log = append(f.log, m)
+}
+
+// full returns the whole state of BitArray as a mutation with sequence seq
+func (f *Changefeed) full(seq uint64) Mutation {
+	words := make([]uint64, len(f.ba.data))
+	for i := range words {
+		words[i] = f.ba.word(i)
+	}
+	return Mutation{Seq: seq, Kind: MutationFull, Length: f.ba.Len(), Words: words}
+}
+
+// Since returns mutations with sequence numbers after seq. For new
+// subscribers passing zero, or when some of the mutations are no longer
+// retained, the result is a single full state marker with the sequence
+// number of the latest mutation instead.
+func (f *Changefeed) Since(seq uint64) []Mutation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if seq == 0 || len(f.log) == 0 || f.log[0].Seq > seq+1 {
+		return []Mutation{f.full(f.seq)}
+	}
+	if seq >= f.seq {
+		return nil
+	}
+	i := sort.Search(len(f.log), func(i int) bool { return f.log[i].Seq > seq })
+	return append([]Mutation(nil), f.log[i:]...)
+}
+
+// Seq returns sequence number of the latest mutation
+func (f *Changefeed) Seq() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// Wait returns a channel closed on the next mutation
+func (f *Changefeed) Wait() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.notify
+}
+
+// Apply applies a mutation of a changefeed to BitArray of a follower.
+//
+// Full state markers of another length resize BitArray,
+// which is not safe for concurrent usage
+func (s *BitArray) Apply(m Mutation) error {
+	switch m.Kind {
+	case MutationWords:
+		if m.Offset < 0 || m.Offset+len(m.Words) > len(s.data) {
+			return ErrLengthMismatch
+		}
+	case MutationFull:
+		if m.Length < 0 || len(m.Words) != (m.Length+63)/64 {
+			return ErrCorruptData
+		}
+		if m.Length != s.Len() {
+			// unmaps data and resizes dirty tracking like Restore
+			s.replace(append([]uint64(nil), m.Words...), m.Length)
+			return nil
+		}
+	default:
+		return ErrCorruptData
+	}
+	if len(m.Words) == 0 {
+		return nil
+	}
+	lo, hi := int64(m.Offset), int64(m.Offset+len(m.Words)-1)
+	s.writing(lo, hi)
+	if s.concurrent {
+		for i, v := range m.Words {
+			atomic.StoreUint64(&s.data[m.Offset+i], v)
+		}
+		s.growBoundsAtomically(hi)
+	} else {
+		copy(s.data[m.Offset:], m.Words)
+		if s.right < hi {
+			s.right = hi
+		}
+	}
+	s.wrote(lo, hi)
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBitArrayChangefeed(t *testing.T) {
+	ba := New(300, false)
+	feed := ba.StartChangefeed(16, 4)
+	wait := feed.Wait()
+
+	ba.Set(3)
+	ba.Set(200)
+	ba.Remove(3)
+	select {
+	case <-wait:
+	default:
+		t.Fatalf("failed on test case 1")
+	}
+
+	ms := feed.Since(1)
+	if len(ms) != 2 || ms[0].Seq != 2 || ms[1].Seq != 3 ||
+		ms[0].Kind != MutationWords || ms[0].Offset != 3 || ms[0].Words[0] != 1<<8 {
+		t.Fatalf("failed on test case 2: %v", ms)
+	}
+
+	// fourth mutation is followed by a full state marker
+	ba.Set(299)
+	ms = feed.Since(3)
+	if len(ms) != 2 || ms[1].Kind != MutationFull || ms[1].Seq != 5 || feed.Seq() != 5 {
+		t.Fatalf("failed on test case 3: %v", ms)
+	}
+
+	follower := New(0, false)
+	for _, m := range feed.Since(0) {
+		if err := follower.Apply(m); err != nil {
+			t.Fatalf("failed on test case 4: %v", err)
+		}
+	}
+	ba.Set(100)
+	for _, m := range feed.Since(5) {
+		follower.Apply(m)
+	}
+	if follower.Len() != 300 || follower.Count() != 3 || !follower.Get(200) || !follower.Get(100) {
+		t.Fatalf("failed on test case 5")
+	}
+	if feed.Since(6) != nil {
+		t.Fatalf("failed on test case 6")
+	}
+
+	ba.StopChangefeed()
+	ba.Set(1)
+	if feed.Seq() != 6 {
+		t.Fatalf("failed on test case 7")
+	}
+}
+
+func TestBitArrayChangefeedTrimmed(t *testing.T) {
+	ba := New(1000, false)
+	feed := ba.StartChangefeed(2, 0)
+	for i := 0; i < 100; i++ {
+		ba.Set(i * 10)
+	}
+
+	// a subscriber too far behind gets the full state
+	ms := feed.Since(1)
+	if len(ms) != 1 || ms[0].Kind != MutationFull || ms[0].Seq != 100 || ms[0].Length != 1000 {
+		t.Fatalf("failed on test case 1")
+	}
+	if len(feed.Since(98)) != 2 {
+		t.Fatalf("failed on test case 2")
+	}
+
+	if err := New(10, false).Apply(Mutation{Kind: MutationWords, Offset: 5, Words: []uint64{1}}); err != ErrLengthMismatch {
+		t.Fatalf("failed on test case 3")
+	}
+	if err := New(10, false).Apply(Mutation{Kind: MutationFull, Length: 100, Words: []uint64{1}}); err != ErrCorruptData {
+		t.Fatalf("failed on test case 4")
+	}
+	// a full state of another length resizes tracking and drops the rank index
+	follower := New(10, false)
+	follower.TrackDirty(1)
+	follower.BuildRankIndex()
+	if err := follower.Apply(ms[0]); err != nil || follower.Len() != 1000 || follower.Count() != 100 {
+		t.Fatalf("failed on test case 5")
+	}
+	if follower.Rank(1000) != 100 || follower.rank.Load() != nil {
+		t.Fatalf("failed on test case 6")
+	}
+	follower.ClearDirty()
+	follower.Set(990)
+	if r := follower.DirtyRegions(); len(r) != 1 || r[0].Start != 960 {
+		t.Fatalf("failed on test case 7")
+	}
+}
+
+func TestBitArrayChangefeedConcurrent(t *testing.T) {
+	ba := New(256, true)
+	feed := ba.StartChangefeed(1<<16, 0)
+	ba.Set(0)
+	follower := New(0, false)
+	follower.Apply(feed.Since(0)[0])
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if i%3 == 0 {
+					ba.RemoveChanged((i * 7) % 256)
+				} else {
+					ba.SetChanged((i*13 + g) % 256)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for _, m := range feed.Since(1) {
+		follower.Apply(m)
+	}
+	if follower.DiffCount(ba) != 0 {
+		t.Fatalf("failed on test case 1")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+// PopMin clears the lowest set bit and returns its index, atomically in
+// concurrent mode so that every set bit is popped by a single caller.
+// It returns false when no bit is set.
+func (s *BitArray) PopMin() (int, bool) {
+	if s == nil {
+		return -1, false
+	}
+	for from := 0; ; {
+		index := s.nextSet(from)
+		if index < 0 {
+			return -1, false
+		}
+		if s.claimSet(index) {
+			return index, true
+		}
+		// taken by another caller
+		from = index
+	}
+}
+
+// PopMax clears the highest set bit and returns its index, atomically in
+// concurrent mode so that every set bit is popped by a single caller.
+// It returns false when no bit is set.
+func (s *BitArray) PopMax() (int, bool) {
+	if s == nil {
+		return -1, false
+	}
+	for from := maxInt; ; {
+		index := s.prevSet(from)
+		if index < 0 {
+			return -1, false
+		}
+		if s.claimSet(index) {
+			return index, true
+		}
+		// taken by another caller
+		from = index
+	}
+}
+
+// claimSet clears the set bit at index and reports whether it was still
+// set, so that exactly one of concurrent callers succeeds
+func (s *BitArray) claimSet(index int) bool {
+	i := int64(index >> 6)
+	var mask uint64 = 1 << (index & 0x3f)
+	s.writing(i, i)
+	if s.concurrent {
+		if andNotWord(&s.data[i], mask)&mask == 0 {
+			s.settled()
+			return false
+		}
+	} else {
+		s.data[i] &^= mask
+	}
+	s.wrote(i, i)
+	return true
+}
+
+// ClaimFirstClear sets the lowest clear bit and returns its index,
+// atomically in concurrent mode so that every bit is claimed by a single
+// caller. It returns false when all bits are set.
+func (s *BitArray) ClaimFirstClear() (int, bool) {
+	if s == nil {
+		return -1, false
+	}
+	for from := 0; ; {
+		index := s.nextClear(from)
+		if index < 0 {
+			return -1, false
+		}
+		if s.claimClear(index) {
+			return index, true
+		}
+		// taken by another caller
+		from = index
+	}
+}
+
+// claimClear sets the clear bit at index and reports whether it was still
+// clear, so that exactly one of concurrent callers succeeds
+func (s *BitArray) claimClear(index int) bool {
+	i := int64(index >> 6)
+	var mask uint64 = 1 << (index & 0x3f)
+	s.writing(i, i)
+	if s.concurrent {
+		if orWord(&s.data[i], mask)&mask != 0 {
+			s.settled()
+			return false
+		}
+		s.growBoundsAtomically(i)
+	} else {
+		s.data[i] |= mask
+		if s.right < i {
+			s.right = i
+		}
+	}
+	s.wrote(i, i)
+	return true
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBitArrayPop(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(1000, concurrent)
+		if _, ok := s.PopMin(); ok {
+			t.Fatalf("failed on test case 1")
+		}
+		if _, ok := s.PopMax(); ok {
+			t.Fatalf("failed on test case 1")
+		}
+		for _, i := range []int{5, 64, 700, 999} {
+			s.Set(i)
+		}
+		if i, ok := s.PopMin(); !ok || i != 5 || s.Get(5) {
+			t.Fatalf("failed on test case 2")
+		}
+		if i, ok := s.PopMax(); !ok || i != 999 || s.Get(999) {
+			t.Fatalf("failed on test case 3")
+		}
+		if i, _ := s.PopMax(); i != 700 {
+			t.Fatalf("failed on test case 4")
+		}
+		if i, _ := s.PopMin(); i != 64 || s.Count() != 0 {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+}
+
+func TestBitArrayPopConcurrent(t *testing.T) {
+	const n = 1 << 14
+	s := New(n, true)
+	s.SetAll()
+	seen := New(n, true)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var popped int
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			pop := s.PopMin
+			if w%2 == 1 {
+				pop = s.PopMax
+			}
+			var cnt int
+			for i, ok := pop(); ok; i, ok = pop() {
+				if !seen.SetChanged(i) {
+					t.Errorf("bit %d popped twice", i)
+				}
+				cnt++
+			}
+			mu.Lock()
+			popped += cnt
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+	if popped != n || s.Count() != 0 || seen.Count() != n {
+		t.Fatalf("failed on test case 1")
+	}
+}
+
+func TestBitArrayClaimFirstClear(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(130, concurrent)
+		s.Set(0)
+		s.Set(2)
+		if i, ok := s.ClaimFirstClear(); !ok || i != 1 || !s.Get(1) {
+			t.Fatalf("failed on test case 1")
+		}
+		if i, _ := s.ClaimFirstClear(); i != 3 {
+			t.Fatalf("failed on test case 2")
+		}
+		for i := 4; i < 129; i++ {
+			s.Set(i)
+		}
+		if i, ok := s.ClaimFirstClear(); !ok || i != 129 || s.Count() != 130 {
+			t.Fatalf("failed on test case 3")
+		}
+		if _, ok := s.ClaimFirstClear(); ok {
+			t.Fatalf("failed on test case 4")
+		}
+		s.Remove(64)
+		if i, _ := s.ClaimFirstClear(); i != 64 {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+}
+
+func TestBitArrayClaimFirstClearConcurrent(t *testing.T) {
+	const n = 1 << 14
+	s := New(n, true)
+	seen := New(n, true)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := s.ClaimFirstClear(); ok; i, ok = s.ClaimFirstClear() {
+				if !seen.SetChanged(i) {
+					t.Errorf("bit %d claimed twice", i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s.Count() != n || seen.Count() != n {
+		t.Fatalf("failed on test case 1")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "runtime"
+
+// consistentRetries bounds optimistic attempts of consistent reads before
+// they exclude writers
+const consistentRetries = 8
+
+// TrackConsistency makes CountConsistent, CloneConsistent and Snapshot of
+// a concurrent BitArray see it at a single instant. Every mutation then
+// adds to two shared counters, which untracked arrays do not pay. It must
+// be called before BitArray is shared with writers.
+func (s *BitArray) TrackConsistency() {
+	s.tracked.Store(true)
+}
+
+// consistent calls fn so that its reads see BitArray at a single instant.
+//
+// Mutations of a tracked concurrent BitArray are counted by writing and
+// settled, fn is retried when one was in flight before it or began during
+// it. After consistentRetries attempts fn runs in an exclusive section:
+// new writers wait at the gate and those in flight are waited for. Without
+// tracking fn reads like any other reader.
+func (s *BitArray) consistent(fn func()) {
+	if !s.concurrent || !s.tracked.Load() {
+		fn()
+		return
+	}
+	for n := 0; n < consistentRetries; n++ {
+		done := s.writesDone.Load()
+		begun := s.writesBegun.Load()
+		if begun == done {
+			fn()
+			if s.writesBegun.Load() == begun {
+				return
+			}
+		}
+		runtime.Gosched()
+	}
+	// batches hold the lock across their writes, so none is half applied
+	s.batch.Lock()
+	defer s.batch.Unlock()
+	s.gated.Store(true)
+	defer s.gated.Store(false)
+	for {
+		done := s.writesDone.Load()
+		if s.writesBegun.Load() == done {
+			break
+		}
+		runtime.Gosched()
+	}
+	fn()
+}
+
+// enterWrite counts a mutation of a tracked BitArray as begun, it waits
+// while an exclusive consistent read runs
+func (s *BitArray) enterWrite() {
+	for {
+		s.writesBegun.Add(1)
+		if !s.gated.Load() {
+			return
+		}
+		// back off without writing so the read sees no writer in flight
+		s.writesDone.Add(1)
+		for s.gated.Load() {
+			runtime.Gosched()
+		}
+	}
+}
+
+// CountConsistent returns count of set bits at a single instant.
+//
+// In concurrent mode Count reads words one at a time and may mix states
+// before and after a write. With TrackConsistency CountConsistent retries
+// the count until no write overlapped it and then briefly holds writers
+// off, without it the count is the one of Count.
+func (s *BitArray) CountConsistent() (cnt int) {
+	if s == nil {
+		return 0
+	}
+	s.consistent(func() { cnt = s.Count() })
+	return cnt
+}
+
+// CloneConsistent returns a copy of BitArray at a single instant, the
+// copy is not concurrent and can be read without synchronization while
+// writers of BitArray go on. Like CountConsistent it needs
+// TrackConsistency to be consistent in concurrent mode.
+func (s *BitArray) CloneConsistent() *BitArray {
+	res := New(s.Len(), false)
+	s.consistent(func() {
+		for i := range res.data {
+			res.data[i] = s.word(i)
+		}
+	})
+	res.right = int64(res.lastIndex() >> 6)
+	if res.right < 0 {
+		res.right = 0
+	}
+	return res
+}
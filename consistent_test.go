@@ -0,0 +1,153 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBitArrayCountConsistent(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(300, concurrent)
+		ba.Set(5)
+		ba.Set(299)
+		if ba.CountConsistent() != 2 {
+			t.Fatalf("failed on test case 1")
+		}
+		// writes that changed nothing must not leave it waiting
+		ba.SetChanged(5)
+		ba.RemoveChanged(6)
+		ba.CompareAndSwapBit(7, true, false)
+		ba.UnifyWith(New(300, false))
+		ba.orFrom(New(10, false))
+		ba.TestAndSet(299)
+		ba.CopyFrom(ba.Clone())
+		if ba.CountConsistent() != 2 || ba.writesBegun.Load() != ba.writesDone.Load() {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+	var ba *BitArray
+	if ba.CountConsistent() != 0 {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBitArrayCountConsistentConcurrent(t *testing.T) {
+	const n = 1 << 14
+	ba := New(n, true)
+	ba.TrackConsistency()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			ba.SetRange(0, n)
+			ba.RemoveRange(0, n)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if c := ba.CountConsistent(); c != 0 && c != n {
+			t.Fatalf("failed on test case 1")
+		}
+	}
+	wg.Wait()
+	if ba.writesBegun.Load() != ba.writesDone.Load() {
+		t.Fatalf("failed on test case 2")
+	}
+}
+
+func TestBitArrayCloneConsistent(t *testing.T) {
+	ba := New(300, true)
+	ba.Set(5)
+	ba.Set(299)
+	c := ba.CloneConsistent()
+	ba.Set(6)
+	if max, _ := c.MaxSet(); max != 299 || c.concurrent || c.Len() != 300 || c.Count() != 2 || !c.Get(299) || c.Get(6) {
+		t.Fatalf("failed on test case 1")
+	}
+	if New(0, true).CloneConsistent().Len() != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+
+	const n = 1 << 14
+	ba = New(n, true)
+	ba.TrackConsistency()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			ba.SetAll()
+			ba.RemoveAll()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if c := ba.CloneConsistent().Count(); c != 0 && c != n {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+	wg.Wait()
+}
+
+func TestBitArrayConsistentExclusive(t *testing.T) {
+	// untracked arrays do not count mutations
+	ba := New(300, true)
+	ba.Set(5)
+	if ba.CountConsistent() != 1 || ba.writesBegun.Load() != 0 || ba.writesDone.Load() != 0 {
+		t.Fatalf("failed on test case 1")
+	}
+
+	// a writer that never pauses does not starve readers
+	const n = 1 << 14
+	ba = New(n, true)
+	ba.TrackConsistency()
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !stop.Load() {
+			ba.SetRange(0, n)
+			ba.RemoveRange(0, n)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if c := ba.CountConsistent(); c != 0 && c != n {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+	if ba.gated.Load() || ba.writesBegun.Load() != ba.writesDone.Load() {
+		t.Fatalf("failed on test case 3")
+	}
+
+	// a writer in flight past the retries is waited for behind the gate
+	ba.writesBegun.Add(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !ba.gated.Load() {
+			runtime.Gosched()
+		}
+		ba.Set(7) // held at the gate until the read ends
+	}()
+	go func() {
+		for !ba.gated.Load() {
+			runtime.Gosched()
+		}
+		time.Sleep(10 * time.Millisecond)
+		ba.settled()
+	}()
+	if ba.CountConsistent() != 0 {
+		t.Fatalf("failed on test case 4")
+	}
+	wg.Wait()
+	if ba.Count() != 1 || ba.writesBegun.Load() != ba.writesDone.Load() {
+		t.Fatalf("failed on test case 5")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "math/bits"
+
+// TwoPhaseSet is a two-phase set CRDT made of an add and a tombstone
+// BitArray. Replicas converge regardless of the order of merges,
+// removed indices can not be added again.
+type TwoPhaseSet struct {
+	added   *BitArray
+	removed *BitArray
+}
+
+// NewTwoPhaseSet returns an instantiated TwoPhaseSet struct.
+//
+// length in bits, concurrent for concurrent safe usage
+func NewTwoPhaseSet(length int, concurrent bool) *TwoPhaseSet {
+	return &TwoPhaseSet{
+		added:   New(length, concurrent),
+		removed: New(length, concurrent),
+	}
+}
+
+// Add index to the set, no effect once it was removed
+func (s *TwoPhaseSet) Add(index int) {
+	s.added.Set(index)
+}
+
+// Remove index from the set for good, no effect unless it was added
+func (s *TwoPhaseSet) Remove(index int) {
+	if s.added.Get(index) {
+		s.removed.SetChanged(index)
+	}
+}
+
+// Contains reports whether index was added and not removed
+func (s *TwoPhaseSet) Contains(index int) bool {
+	return s.added.Get(index) && !s.removed.Get(index)
+}
+
+// Count of indices in the set
+func (s *TwoPhaseSet) Count() int {
+	var cnt int
+	for i, last := 0, s.added.lastWord(); i <= last; i++ {
+		var r uint64
+		if i < len(s.removed.data) {
+			r = s.removed.word(i)
+		}
+		cnt += bits.OnesCount64(s.added.word(i) &^ r)
+	}
+	return cnt
+}
+
+// Merge state of another replica into the set. Merge is commutative,
+// associative and idempotent, growing the set to the length of other.
+//
+// Growing is not safe for concurrent usage
+func (s *TwoPhaseSet) Merge(other *TwoPhaseSet) {
+	s.added.orFrom(other.added)
+	s.removed.orFrom(other.removed)
+}
+
+// Added returns the add BitArray, for shipping state to other replicas.
+// It must not be modified.
+func (s *TwoPhaseSet) Added() *BitArray {
+	return s.added
+}
+
+// Removed returns the tombstone BitArray, for shipping state to other
+// replicas. It must not be modified.
+func (s *TwoPhaseSet) Removed() *BitArray {
+	return s.removed
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestTwoPhaseSet(t *testing.T) {
+	a := NewTwoPhaseSet(100, false)
+	b := NewTwoPhaseSet(200, true)
+
+	a.Add(1)
+	a.Add(2)
+	a.Remove(2)
+	a.Remove(3)
+	b.Add(3)
+	b.Add(150)
+	b.Add(2)
+
+	if !a.Contains(1) || a.Contains(2) || a.Contains(3) || a.Count() != 1 {
+		t.Fatalf("failed on test case 1")
+	}
+
+	a.Merge(b)
+	b.Merge(a)
+	a.Merge(b)
+	for _, s := range []*TwoPhaseSet{a, b} {
+		if !s.Contains(1) || s.Contains(2) || !s.Contains(3) || !s.Contains(150) || s.Count() != 3 {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+	if a.Added().DiffCount(b.Added()) != 0 || a.Removed().DiffCount(b.Removed()) != 0 {
+		t.Fatalf("failed on test case 3")
+	}
+
+	// removed indices can not come back
+	a.Add(2)
+	if a.Contains(2) {
+		t.Fatalf("failed on test case 4")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// TrackDirty enables tracking of modified regions, wordsPerRegion words of
+// 64 bits each, so only changed parts of BitArray have to be persisted.
+// 512 words per region match 4 KiB pages. Zero or less disables tracking.
+//
+// Not safe for concurrent usage, set it up before sharing BitArray
+func (s *BitArray) TrackDirty(wordsPerRegion int) {
+	if s == nil {
+		return
+	}
+	if wordsPerRegion <= 0 {
+		s.dirty = nil
+		s.dirtyWords = 0
+		return
+	}
+	s.dirtyWords = int64(wordsPerRegion)
+	s.dirty = New((len(s.data)+wordsPerRegion-1)/wordsPerRegion, s.concurrent)
+}
+
+func (s *BitArray) markDirty(lo, hi int64) {
+	for r := lo / s.dirtyWords; r <= hi/s.dirtyWords; r++ {
+		s.dirty.SetChanged(int(r))
+	}
+}
+
+// DirtyRegions returns ascending bit ranges modified since tracking was
+// enabled or since the last ClearDirty, adjacent regions are merged
+func (s *BitArray) DirtyRegions() []Range {
+	if s == nil || s.dirty == nil {
+		return nil
+	}
+	var res []Range
+	for r := s.dirty.nextSet(0); r >= 0; r = s.dirty.nextSet(r + 1) {
+		res = s.appendRegion(res, r)
+	}
+	return res
+}
+
+// ClearDirty forgets modified regions and returns them like DirtyRegions.
+//
+// Regions are taken atomically in concurrent mode, so mutations racing
+// with ClearDirty are either returned or reported by the next call.
+// Read data of the returned regions after ClearDirty to persist them.
+func (s *BitArray) ClearDirty() []Range {
+	if s == nil || s.dirty == nil {
+		return nil
+	}
+	var res []Range
+	for i := range s.dirty.data {
+		var v uint64
+		if s.concurrent {
+			v = atomic.SwapUint64(&s.dirty.data[i], 0)
+		} else {
+			v, s.dirty.data[i] = s.dirty.data[i], 0
+		}
+		for ; v != 0; v &= v - 1 {
+			res = s.appendRegion(res, i<<6+bits.TrailingZeros64(v))
+		}
+	}
+	return res
+}
+
+// appendRegion appends bit range of dirty region r to res,
+// merging it with the last range when adjacent
+func (s *BitArray) appendRegion(res []Range, r int) []Range {
+	size := int(s.dirtyWords) * 64
+	start, end := r*size, (r+1)*size
+	if n := s.Len(); end > n {
+		end = n
+	}
+	if len(res) > 0 && res[len(res)-1].End == start {
+		res[len(res)-1].End = end
+		return res
+	}
+	return append(res, Range{Start: start, End: end})
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBitArrayDirtyRegions(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		ba.TrackDirty(2)
+
+		if ba.DirtyRegions() != nil {
+			t.Fatalf("failed on test case 1")
+		}
+
+		ba.Set(5)
+		ba.Set(130)
+		ba.Remove(300)
+		ba.SetChanged(999)
+		want := []Range{{0, 384}, {896, 1000}}
+		if r := ba.DirtyRegions(); !reflect.DeepEqual(r, want) {
+			t.Fatalf("failed on test case 2: %v", r)
+		}
+		if r := ba.ClearDirty(); !reflect.DeepEqual(r, want) {
+			t.Fatalf("failed on test case 3: %v", r)
+		}
+		if ba.DirtyRegions() != nil {
+			t.Fatalf("failed on test case 4")
+		}
+
+		ba.RemoveChanged(500)
+		if ba.DirtyRegions() != nil {
+			t.Fatalf("failed on test case 5")
+		}
+
+		ba.RemoveAll()
+		if r := ba.DirtyRegions(); !reflect.DeepEqual(r, []Range{{0, 1000}}) {
+			t.Fatalf("failed on test case 6: %v", r)
+		}
+
+		ba.TrackDirty(0)
+		ba.Set(1)
+		if ba.DirtyRegions() != nil {
+			t.Fatalf("failed on test case 7")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// DumpOptions configures the output of Dump
+type DumpOptions struct {
+	LineBits  int  // bits per line, 64 if zero
+	GroupBits int  // bits per space separated group, 8 if zero
+	Verbose   bool // do not elide repeated all-zero or all-one lines
+}
+
+// Dump writes an offset annotated dump of bits to w, like hexdump -C does
+// for bytes.
+//
+// Every line starts with the index of its first bit and ends with the count
+// of set bits in the line. Repeated all-zero or all-one lines are collapsed
+// into a single "*" line unless opts.Verbose is set. The last line holds
+// the length of BitArray.
+func (s *BitArray) Dump(w io.Writer, opts DumpOptions) error {
+	if opts.LineBits <= 0 {
+		opts.LineBits = 64
+	}
+	if opts.GroupBits <= 0 {
+		opts.GroupBits = 8
+	}
+	n := s.Len()
+	digits := len(strconv.Itoa(n))
+	if digits < 8 {
+		digits = 8
+	}
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, 2*opts.LineBits+digits+16)
+	prev, elided := -1, false
+	for off := 0; off < n; off += opts.LineBits {
+		end := off + opts.LineBits
+		if end > n {
+			end = n
+		}
+		cnt := s.CountRange(off, end)
+		// 0 for all-zero, 1 for all-one and 2 for mixed lines
+		kind := 2
+		if cnt == 0 {
+			kind = 0
+		} else if cnt == end-off {
+			kind = 1
+		}
+		if !opts.Verbose && kind < 2 && kind == prev && end-off == opts.LineBits {
+			if !elided {
+				bw.WriteString("*\n")
+				elided = true
+			}
+			continue
+		}
+		prev, elided = kind, false
+
+		buf = appendOffset(buf[:0], off, digits)
+		buf = append(buf, ' ')
+		for i := off; i < end; i++ {
+			if (i-off)%opts.GroupBits == 0 {
+				buf = append(buf, ' ')
+			}
+			if s.Get(i) {
+				buf = append(buf, '1')
+			} else {
+				buf = append(buf, '0')
+			}
+		}
+		buf = append(buf, "  |"...)
+		buf = strconv.AppendInt(buf, int64(cnt), 10)
+		buf = append(buf, "|\n"...)
+		bw.Write(buf)
+	}
+	buf = appendOffset(buf[:0], n, digits)
+	buf = append(buf, '\n')
+	bw.Write(buf)
+	return bw.Flush()
+}
+
+// appendOffset appends v zero-padded to digits
+func appendOffset(buf []byte, v int, digits int) []byte {
+	s := strconv.Itoa(v)
+	for i := len(s); i < digits; i++ {
+		buf = append(buf, '0')
+	}
+	return append(buf, s...)
+}
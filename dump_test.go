@@ -0,0 +1,51 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBitArrayDump(t *testing.T) {
+	ba := New(80, false)
+	ba.Set(0)
+	ba.Set(9)
+	ba.Set(79)
+
+	var buf bytes.Buffer
+	if err := ba.Dump(&buf, DumpOptions{LineBits: 16, GroupBits: 4}); err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	t.Log("\n" + buf.String())
+	want := "00000000  1000 0000 0100 0000  |2|\n" +
+		"00000016  0000 0000 0000 0000  |0|\n" +
+		"*\n" +
+		"00000064  0000 0000 0000 0001  |1|\n" +
+		"00000080\n"
+	if buf.String() != want {
+		t.Fatalf("failed on test case 2")
+	}
+
+	buf.Reset()
+	ba.Dump(&buf, DumpOptions{LineBits: 16, GroupBits: 4, Verbose: true})
+	if bytes.Count(buf.Bytes(), []byte("\n")) != 6 {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBitArrayDumpOnes(t *testing.T) {
+	ba := New(200, true)
+	ba.SetAll()
+
+	var buf bytes.Buffer
+	ba.Dump(&buf, DumpOptions{})
+	t.Log("\n" + buf.String())
+	want := "00000000  11111111 11111111 11111111 11111111 11111111 11111111 11111111 11111111  |64|\n" +
+		"*\n" +
+		"00000192  11111111  |8|\n" +
+		"00000200\n"
+	if buf.String() != want {
+		t.Fatalf("failed on test case 1")
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+
+//go:build !purego
+
+package goba
+
+import "unsafe"
+
+var isLE bool
+
+func init() {
+	var x uint16 = 0xff00
+	xb := *(*[2]byte)(unsafe.Pointer(&x))
+	isLE = (xb[0] == 0x00)
+}
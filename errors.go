@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Errors returned by the package are these values or wrap them,
+// so failure modes can be told apart with errors.Is
+var (
+	// index is outside of BitArray
+	ErrIndexOutOfRange = errors.New("goba: index out of range")
+	// lengths of operands do not fit each other
+	ErrLengthMismatch = errors.New("goba: length mismatch")
+	// serialized data is malformed or damaged
+	ErrCorruptData = errors.New("goba: corrupt data")
+	// serialized data has a format version this package cannot read
+	ErrFormatVersion = errors.New("goba: unsupported format version")
+	// requested version is not committed yet or no longer retained
+	ErrVersionUnavailable = errors.New("goba: version unavailable")
+	// allocation would take a tenant over its quota
+	ErrQuotaExceeded = errors.New("goba: quota exceeded")
+	// text does not follow the expected syntax
+	ErrSyntax = errors.New("goba: invalid syntax")
+	// no free bits are left for an allocation
+	ErrExhausted = errors.New("goba: no free bits left")
+	// a parameter is outside of its valid values
+	ErrInvalidArgument = errors.New("goba: invalid argument")
+	// a value is used after Close
+	ErrClosed = errors.New("goba: use of closed value")
+	// a filter could not be built of its keys
+	ErrConstructionFailed = errors.New("goba: filter construction failed")
+)
+
+// RangeError describes an index outside of BitArray,
+// it matches ErrIndexOutOfRange
+type RangeError struct {
+	Index  int
+	Length int
+}
+
+func (e *RangeError) Error() string {
+	return "goba: index " + strconv.Itoa(e.Index) +
+		" out of range [0:" + strconv.Itoa(e.Length) + "]"
+}
+
+func (e *RangeError) Is(target error) bool {
+	return target == ErrIndexOutOfRange
+}
+
+// QuotaError describes an allocation over the quota of a tenant,
+// it matches ErrQuotaExceeded
+type QuotaError struct {
+	Tenant    string
+	Used      int // bytes allocated by the tenant
+	Requested int // bytes of the failed allocation
+	Quota     int
+}
+
+func (e *QuotaError) Error() string {
+	return "goba: quota of tenant " + strconv.Quote(e.Tenant) + " exceeded: " +
+		strconv.Itoa(e.Used) + " + " + strconv.Itoa(e.Requested) + " > " + strconv.Itoa(e.Quota) + " bytes"
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// CorruptionError lists bit ranges of damaged chunks of serialized data,
+// it matches ErrCorruptData
+type CorruptionError struct {
+	Ranges []Range
+}
+
+func (e *CorruptionError) Error() string {
+	buf := []byte("goba: corrupt data at bits")
+	for i, r := range e.Ranges {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, " ["...)
+		buf = strconv.AppendInt(buf, int64(r.Start), 10)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(r.End), 10)
+		buf = append(buf, ')')
+	}
+	return string(buf)
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorruptData
+}
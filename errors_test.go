@@ -0,0 +1,23 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRangeError(t *testing.T) {
+	var err error = &RangeError{Index: 10, Length: 8}
+
+	if err.Error() != "goba: index 10 out of range [0:8]" {
+		t.Fatalf("failed on test case 1: %s", err)
+	}
+	if !errors.Is(fmt.Errorf("wrapped: %w", err), ErrIndexOutOfRange) {
+		t.Fatalf("failed on test case 2")
+	}
+	if errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("failed on test case 3")
+	}
+}
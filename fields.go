@@ -0,0 +1,287 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// FieldType is a signed or unsigned integer type of 1 to 64 bits,
+// unsigned types are limited to 63 bits as in Redis BITFIELD
+type FieldType struct {
+	Bits   int
+	Signed bool
+}
+
+// Signed returns the signed integer type of n bits, like i8 in Redis
+func Signed(n int) FieldType {
+	return FieldType{Bits: n, Signed: true}
+}
+
+// Unsigned returns the unsigned integer type of n bits, like u8 in Redis
+func Unsigned(n int) FieldType {
+	return FieldType{Bits: n}
+}
+
+func (t FieldType) valid() bool {
+	if t.Signed {
+		return t.Bits >= 1 && t.Bits <= 64
+	}
+	return t.Bits >= 1 && t.Bits <= 63
+}
+
+func (t FieldType) bounds() (min, max int64) {
+	if !t.Signed {
+		return 0, 1<<t.Bits - 1
+	}
+	if t.Bits == 64 {
+		return math.MinInt64, math.MaxInt64
+	}
+	return -1 << (t.Bits - 1), 1<<(t.Bits-1) - 1
+}
+
+// decode returns the integer value of t stored in the low bits of v
+func (t FieldType) decode(v uint64) int64 {
+	if t.Signed && t.Bits < 64 && v&(1<<(t.Bits-1)) != 0 {
+		v |= ^uint64(0) << t.Bits
+	}
+	return int64(v)
+}
+
+func (t FieldType) String() string {
+	if t.Signed {
+		return fmt.Sprintf("i%d", t.Bits)
+	}
+	return fmt.Sprintf("u%d", t.Bits)
+}
+
+// Overflow is the overflow handling of Fields writes
+type Overflow int
+
+const (
+	// OverflowWrap wraps values around, the default
+	OverflowWrap Overflow = iota
+	// OverflowSat saturates values at the minimum or maximum of the type
+	OverflowSat
+	// OverflowFail skips the write and reports a nil result
+	OverflowFail
+)
+
+type fieldOpKind int
+
+const (
+	fieldGet fieldOpKind = iota
+	fieldSet
+	fieldIncrBy
+)
+
+type fieldOp struct {
+	kind     fieldOpKind
+	typ      FieldType
+	offset   int
+	value    int64
+	overflow Overflow
+}
+
+// FieldResult is the result of a Fields operation, OK is false for
+// writes skipped by OverflowFail, where Redis replies nil
+type FieldResult struct {
+	Value int64
+	OK    bool
+}
+
+// Fields is a batch of integer operations on BitArray, the equivalent of
+// Redis BITFIELD. Bit offset o is the most significant bit of a field,
+// so fields read the same as in Redis after Set of the same offsets.
+type Fields struct {
+	s        *BitArray
+	ops      []fieldOp
+	overflow Overflow
+}
+
+// Fields returns an empty batch of operations on BitArray
+func (s *BitArray) Fields() *Fields {
+	return &Fields{s: s}
+}
+
+// Get appends reading of the field of type t at bit offset
+func (f *Fields) Get(t FieldType, offset int) *Fields {
+	f.ops = append(f.ops, fieldOp{kind: fieldGet, typ: t, offset: offset})
+	return f
+}
+
+// Set appends writing of value to the field, its result is the old value
+func (f *Fields) Set(t FieldType, offset int, value int64) *Fields {
+	f.ops = append(f.ops, fieldOp{fieldSet, t, offset, value, f.overflow})
+	return f
+}
+
+// IncrBy appends adding of incr to the field, its result is the new value
+func (f *Fields) IncrBy(t FieldType, offset int, incr int64) *Fields {
+	f.ops = append(f.ops, fieldOp{fieldIncrBy, t, offset, incr, f.overflow})
+	return f
+}
+
+// Overflow sets overflow handling of the following Set and IncrBy
+func (f *Fields) Overflow(o Overflow) *Fields {
+	f.overflow = o
+	return f
+}
+
+// Exec applies the batch and returns one result per operation.
+//
+// Operations are validated first, so an invalid type or a field beyond the
+// length fails the whole batch with nothing written. Batches on the same
+// BitArray are applied one at a time and CountConsistent, CloneConsistent
+// and Snapshot see either none or all writes of a batch. In concurrent mode
+// a field within a word is read, changed and written by a single atomic
+// compare and swap, so concurrent Set and Remove calls are not lost. A
+// field across two words takes a swap per word and a concurrent write to
+// its own bits between them may be lost.
+func (f *Fields) Exec() ([]FieldResult, error) {
+	s := f.s
+	n := s.Len()
+	lo, hi := -1, -1 // words of written fields
+	for _, op := range f.ops {
+		if !op.typ.valid() {
+			return nil, fmt.Errorf("%w: field type %v", ErrInvalidArgument, op.typ)
+		}
+		if op.offset < 0 || op.offset > n-op.typ.Bits {
+			index := op.offset
+			if index <= maxInt-op.typ.Bits {
+				index += op.typ.Bits - 1 // the last bit of the field
+			}
+			return nil, &RangeError{Index: index, Length: n}
+		}
+		if op.kind != fieldGet {
+			if first := op.offset >> 6; lo < 0 || first < lo {
+				lo = first
+			}
+			if last := (op.offset + op.typ.Bits - 1) >> 6; last > hi {
+				hi = last
+			}
+		}
+	}
+	s.batch.Lock()
+	defer s.batch.Unlock()
+	if lo >= 0 {
+		s.writing(int64(lo), int64(hi))
+	}
+	res := make([]FieldResult, len(f.ops))
+	for i, op := range f.ops {
+		switch op.kind {
+		case fieldGet:
+			res[i] = FieldResult{s.field(op.typ, op.offset), true}
+		case fieldSet:
+			old, _, ok := s.updateField(op.typ, op.offset, func(int64) (int64, bool) {
+				return op.typ.fit(op.value, op.overflow)
+			})
+			res[i] = FieldResult{old, ok}
+		case fieldIncrBy:
+			_, v, ok := s.updateField(op.typ, op.offset, func(old int64) (int64, bool) {
+				return op.typ.add(old, op.value, op.overflow)
+			})
+			res[i] = FieldResult{v, ok}
+		}
+		if !res[i].OK {
+			res[i].Value = 0
+		}
+	}
+	if lo >= 0 {
+		if s.concurrent {
+			s.growBoundsAtomically(int64(hi))
+		} else if s.right < int64(hi) {
+			s.right = int64(hi)
+		}
+		s.wrote(int64(lo), int64(hi))
+	}
+	return res, nil
+}
+
+// field returns the value of type t at offset, most significant bit first
+func (s *BitArray) field(t FieldType, offset int) int64 {
+	v := bits.Reverse64(s.bitsAt(offset, t.Bits)) >> (64 - t.Bits)
+	return t.decode(v)
+}
+
+// updateField replaces the field of type t at offset with fn of its value
+// and returns the old and the new value, nothing is written when fn fails.
+// A field within a word of a concurrent BitArray is swapped atomically.
+func (s *BitArray) updateField(t FieldType, offset int, fn func(old int64) (int64, bool)) (int64, int64, bool) {
+	i, off := offset>>6, offset&0x3f
+	if !s.concurrent || off+t.Bits > 64 {
+		old := s.field(t, offset)
+		v, ok := fn(old)
+		if ok {
+			s.storeBits(offset, t.Bits, bits.Reverse64(uint64(v)<<(64-t.Bits)))
+		}
+		return old, v, ok
+	}
+	mask := ^uint64(0)
+	if t.Bits < 64 {
+		mask = 1<<t.Bits - 1
+	}
+	for {
+		w := atomic.LoadUint64(&s.data[i])
+		old := t.decode(bits.Reverse64(w>>off&mask) >> (64 - t.Bits))
+		v, ok := fn(old)
+		if !ok {
+			return old, v, false
+		}
+		enc := bits.Reverse64(uint64(v)<<(64-t.Bits)) & mask
+		if atomic.CompareAndSwapUint64(&s.data[i], w, w&^(mask<<off)|enc<<off) {
+			return old, v, true
+		}
+	}
+}
+
+// fit returns v converted to t under overflow handling o
+func (t FieldType) fit(v int64, o Overflow) (int64, bool) {
+	min, max := t.bounds()
+	switch {
+	case v >= min && v <= max:
+		return v, true
+	case o == OverflowSat && v < min:
+		return min, true
+	case o == OverflowSat:
+		return max, true
+	case o == OverflowWrap:
+		return t.wrap(uint64(v)), true
+	}
+	return 0, false
+}
+
+// add returns old+incr of t under overflow handling o
+func (t FieldType) add(old, incr int64, o Overflow) (int64, bool) {
+	min, max := t.bounds()
+	var up, down bool
+	if t.Signed {
+		up = incr > 0 && old > max-incr
+		down = incr < 0 && old < min-incr
+	} else {
+		up = incr > 0 && uint64(incr) > uint64(max-old)
+		down = incr < 0 && uint64(-incr) > uint64(old)
+	}
+	switch {
+	case !up && !down:
+		return old + incr, true
+	case o == OverflowSat && up:
+		return max, true
+	case o == OverflowSat:
+		return min, true
+	case o == OverflowWrap:
+		return t.wrap(uint64(old) + uint64(incr)), true
+	}
+	return 0, false
+}
+
+// wrap truncates v to the bits of t
+func (t FieldType) wrap(v uint64) int64 {
+	if t.Bits < 64 {
+		v &= 1<<t.Bits - 1
+	}
+	return t.decode(v)
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(256, concurrent)
+		res, err := s.Fields().IncrBy(Signed(5), 100, 1).Get(Unsigned(4), 0).Exec()
+		if err != nil || res[0] != (FieldResult{1, true}) || res[1] != (FieldResult{0, true}) {
+			t.Fatalf("failed on test case 1")
+		}
+		// most significant bit first
+		if !s.Get(104) || s.Count() != 1 {
+			t.Fatalf("failed on test case 2")
+		}
+		res, _ = s.Fields().Set(Unsigned(8), 60, 0x81).Get(Unsigned(8), 60).Exec()
+		if res[0] != (FieldResult{0, true}) || res[1] != (FieldResult{0x81, true}) ||
+			!s.Get(60) || !s.Get(67) || s.Count() != 3 {
+			t.Fatalf("failed on test case 3")
+		}
+		var got []FieldResult
+		for i := 0; i < 4; i++ {
+			res, _ = s.Fields().Overflow(OverflowSat).IncrBy(Unsigned(2), 200, 1).
+				Overflow(OverflowFail).IncrBy(Unsigned(2), 210, 1).Exec()
+			got = append(got, res...)
+		}
+		if got[6] != (FieldResult{3, true}) || got[7] != (FieldResult{0, false}) || got[5] != (FieldResult{3, true}) {
+			t.Fatalf("failed on test case 4")
+		}
+		res, _ = s.Fields().Set(Signed(8), 120, 200).Get(Signed(8), 120).
+			Overflow(OverflowSat).Set(Signed(8), 120, -1000).Get(Signed(8), 120).
+			IncrBy(Signed(8), 120, -1).Overflow(OverflowWrap).IncrBy(Signed(8), 120, -1).Exec()
+		if res[1].Value != -56 || res[3].Value != -128 || res[4].Value != -128 || res[5].Value != 127 {
+			t.Fatalf("failed on test case 5")
+		}
+		res, _ = s.Fields().Set(Signed(64), 130, math.MinInt64).IncrBy(Signed(64), 130, -1).
+			Overflow(OverflowSat).IncrBy(Signed(64), 130, math.MinInt64).
+			Set(Unsigned(63), 130, -1).Get(Unsigned(63), 130).Exec()
+		if res[1].Value != math.MaxInt64 || res[2].Value != -1 || res[4].Value != 0 {
+			t.Fatalf("failed on test case 6")
+		}
+		// invalid batches write nothing
+		before := s.Clone()
+		if _, err = s.Fields().Set(Unsigned(8), 0, 1).Set(Unsigned(8), 250, 1).Exec(); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Fatalf("failed on test case 7")
+		}
+		if _, err = s.Fields().Set(Unsigned(8), 0, 1).Get(Unsigned(64), 0).Exec(); !errors.Is(err, ErrInvalidArgument) || s.DiffCount(before) != 0 {
+			t.Fatalf("failed on test case 8")
+		}
+		if _, err = s.Fields().Set(Unsigned(8), math.MaxInt64, 1).Exec(); !errors.Is(err, ErrIndexOutOfRange) || s.DiffCount(before) != 0 {
+			t.Fatalf("failed on test case 9")
+		}
+		if s.CountConsistent() != before.Count() {
+			t.Fatalf("failed on test case 10")
+		}
+	}
+}
+
+func TestFieldsConcurrent(t *testing.T) {
+	// a plain Set on bits of a field during increments is not lost
+	s := New(1024, true)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.Fields().IncrBy(Unsigned(8), 0, 1).Exec()
+		}
+	}()
+	s.Set(0) // the most significant bit of the field
+	wg.Wait()
+	if res, _ := s.Fields().Get(Unsigned(8), 0).Exec(); res[0].Value != 228 {
+		t.Fatalf("failed on test case 1")
+	}
+
+	// consistent readers see a batch whole
+	s = New(1024, true)
+	s.TrackConsistency()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.Fields().Set(Unsigned(8), 0, 255).Set(Unsigned(8), 900, 255).Exec()
+			s.Fields().Set(Unsigned(8), 0, 0).Set(Unsigned(8), 900, 0).Exec()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if c := s.CountConsistent(); c != 0 && c != 16 {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+// LoadOptions configures LoadFromFile
+type LoadOptions struct {
+	// Concurrent makes the loaded BitArray safe for concurrent usage
+	Concurrent bool
+	// Salvage loads intact chunks of a damaged file, damaged ones read
+	// as zero and are reported along with the result
+	Salvage bool
+}
+
+// SaveToFile writes a consistent snapshot of BitArray to path with a
+// checksum per chunk, while concurrent writers proceed. The file is
+// replaced atomically.
+func (s *BitArray) SaveToFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".goba-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err = s.export(w, bitArrayV2); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFromFile returns BitArray read from a file written by SaveToFile or
+// a snapshot stored in a file.
+//
+// Damaged chunks fail the load with a CorruptionError listing their bit
+// ranges. With Salvage the rest is loaded and returned together with the
+// CorruptionError.
+func LoadFromFile(path string, opts LoadOptions) (*BitArray, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, length, err := readBitArray(bufio.NewReader(f), opts.Salvage)
+	if data == nil && err != nil {
+		return nil, err
+	}
+	res := New(0, opts.Concurrent)
+	res.replace(data, length)
+	return res, err
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBitArraySaveLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ba.goba")
+	ba := New(3*snapshotChunk*64+100, true)
+	for i := 0; i < ba.Len(); i += 5 {
+		ba.Set(i)
+	}
+	if err := ba.SaveToFile(path); err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	res, err := LoadFromFile(path, LoadOptions{Concurrent: true})
+	if err != nil || res.Len() != ba.Len() || res.DiffCount(ba) != 0 {
+		t.Fatalf("failed on test case 2: %v", err)
+	}
+	// checksummed data restores as well
+	raw, _ := os.ReadFile(path)
+	if err = New(0, false).Restore(bytes.NewReader(raw)); err != nil {
+		t.Fatalf("failed on test case 3: %v", err)
+	}
+
+	// damage the second and the last chunk
+	chunkBytes := 16 + 8*snapshotChunk
+	bad := append([]byte(nil), raw...)
+	bad[headerSize+16+chunkBytes+100] ^= 1
+	bad[len(bad)-5] ^= 1
+	os.WriteFile(path, bad, 0o644)
+	_, err = LoadFromFile(path, LoadOptions{})
+	var ce *CorruptionError
+	if !errors.Is(err, ErrCorruptData) || !errors.As(err, &ce) || len(ce.Ranges) != 2 {
+		t.Fatalf("failed on test case 4: %v", err)
+	}
+	if ce.Ranges[0] != (Range{snapshotChunk * 64, 2 * snapshotChunk * 64}) ||
+		ce.Ranges[1] != (Range{3 * snapshotChunk * 64, ba.Len()}) {
+		t.Fatalf("failed on test case 5: %v", err)
+	}
+	res, err = LoadFromFile(path, LoadOptions{Salvage: true})
+	if !errors.As(err, &ce) || res == nil || res.Len() != ba.Len() {
+		t.Fatalf("failed on test case 6: %v", err)
+	}
+	if res.Count() != ba.CountRange(0, snapshotChunk*64)+ba.CountRange(2*snapshotChunk*64, 3*snapshotChunk*64) {
+		t.Fatalf("failed on test case 7")
+	}
+
+	// a truncated file loses the chunks from the cut on
+	os.WriteFile(path, raw[:headerSize+16+chunkBytes+10], 0o644)
+	res, err = LoadFromFile(path, LoadOptions{Salvage: true})
+	if !errors.As(err, &ce) || len(ce.Ranges) != 1 || ce.Ranges[0] != (Range{snapshotChunk * 64, ba.Len()}) ||
+		res.Count() != ba.CountRange(0, snapshotChunk*64) {
+		t.Fatalf("failed on test case 8: %v", err)
+	}
+
+	// the header is not recoverable
+	bad = append([]byte(nil), raw...)
+	bad[headerSize+2] ^= 1
+	os.WriteFile(path, bad, 0o644)
+	if res, err = LoadFromFile(path, LoadOptions{Salvage: true}); res != nil || !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 9: %v", err)
+	}
+	if _, err = LoadFromFile(filepath.Join(t.TempDir(), "missing"), LoadOptions{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("failed on test case 10: %v", err)
+	}
+}
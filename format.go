@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Number of set indices printed by %v when no precision is given
+const formatIndices = 16
+
+// Format implements fmt.Formatter.
+//
+// %b prints bits in index order, %x prints bytes in hex where bit 0 is the
+// lowest bit of the first byte, %v and %s print a summary with length,
+// count and first set indices. Precision limits the number of printed bits,
+// hex digits or indices, width pads the result.
+func (s *BitArray) Format(f fmt.State, verb rune) {
+	if s == nil {
+		pad(f, []byte("<nil>"))
+		return
+	}
+	prec, hasPrec := f.Precision()
+	switch verb {
+	case 'b':
+		n := s.Len()
+		if hasPrec && prec < n {
+			n = prec
+		}
+		buf := make([]byte, 0, n+3)
+		for i := 0; i < n; i++ {
+			if s.Get(i) {
+				buf = append(buf, '1')
+			} else {
+				buf = append(buf, '0')
+			}
+		}
+		if n < s.Len() {
+			buf = append(buf, "..."...)
+		}
+		pad(f, buf)
+	case 'x', 'X':
+		digits := "0123456789abcdef"
+		if verb == 'X' {
+			digits = "0123456789ABCDEF"
+		}
+		total := (s.Len() + 7) / 8 * 2
+		n := total
+		if hasPrec && prec < n {
+			n = prec
+		}
+		buf := make([]byte, 0, n+3)
+		for i := 0; i < n; i++ {
+			// high nibble of each byte goes first
+			nibble := i ^ 1
+			v := s.word(nibble>>4) >> ((nibble & 0xf) << 2) & 0xf
+			buf = append(buf, digits[v])
+		}
+		if n < total {
+			buf = append(buf, "..."...)
+		}
+		pad(f, buf)
+	case 'v', 's':
+		n := formatIndices
+		if hasPrec {
+			n = prec
+		}
+		buf := []byte("{len:")
+		buf = strconv.AppendInt(buf, int64(s.Len()), 10)
+		buf = append(buf, " count:"...)
+		buf = strconv.AppendInt(buf, int64(s.Count()), 10)
+		buf = append(buf, " set:["...)
+		for i, k := s.nextSet(0), 0; i >= 0; i, k = s.nextSet(i+1), k+1 {
+			if k == n {
+				buf = append(buf, " ..."...)
+				break
+			}
+			if k > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = strconv.AppendInt(buf, int64(i), 10)
+		}
+		buf = append(buf, "]}"...)
+		pad(f, buf)
+	default:
+		fmt.Fprintf(f, "%%!%c(*goba.BitArray)", verb)
+	}
+}
+
+// pad writes buf to f, padded with spaces up to the width of f
+func pad(f fmt.State, buf []byte) {
+	width, ok := f.Width()
+	if !ok || width <= len(buf) {
+		f.Write(buf)
+		return
+	}
+	spaces := make([]byte, width-len(buf))
+	for i := range spaces {
+		spaces[i] = ' '
+	}
+	if f.Flag('-') {
+		f.Write(buf)
+		f.Write(spaces)
+	} else {
+		f.Write(spaces)
+		f.Write(buf)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBitArrayFormat(t *testing.T) {
+	ba := New(12, false)
+	ba.Set(0)
+	ba.Set(3)
+	ba.Set(9)
+
+	if s := fmt.Sprintf("%b", ba); s != "100100000100" {
+		t.Fatalf("failed on test case 1: %s", s)
+	}
+	if s := fmt.Sprintf("%.5b", ba); s != "10010..." {
+		t.Fatalf("failed on test case 2: %s", s)
+	}
+	if s := fmt.Sprintf("%x", ba); s != "0902" {
+		t.Fatalf("failed on test case 3: %s", s)
+	}
+	if s := fmt.Sprintf("%.2x", ba); s != "09..." {
+		t.Fatalf("failed on test case 4: %s", s)
+	}
+	if s := fmt.Sprintf("%v", ba); s != "{len:12 count:3 set:[0 3 9]}" {
+		t.Fatalf("failed on test case 5: %s", s)
+	}
+	if s := fmt.Sprintf("%.2v", ba); s != "{len:12 count:3 set:[0 3 ...]}" {
+		t.Fatalf("failed on test case 6: %s", s)
+	}
+	if s := fmt.Sprintf("%6x|%-6x", ba, ba); s != "  0902|0902  " {
+		t.Fatalf("failed on test case 7: %s", s)
+	}
+	if s := fmt.Sprintf("%d", ba); s != "%!d(*goba.BitArray)" {
+		t.Fatalf("failed on test case 8: %s", s)
+	}
+	var nilba *BitArray
+	if s := fmt.Sprintf("%v", nilba); s != "<nil>" {
+		t.Fatalf("failed on test case 9: %s", s)
+	}
+}
+
+func TestBitArrayFormatConcurrent(t *testing.T) {
+	ba := New(130, true)
+	ba.Set(64)
+	ba.Set(129)
+
+	if s := fmt.Sprintf("%s", ba); s != "{len:130 count:2 set:[64 129]}" {
+		t.Fatalf("failed on test case 1: %s", s)
+	}
+	if s := fmt.Sprintf("%X", ba); s != "0000000000000000010000000000000002" {
+		t.Fatalf("failed on test case 2: %s", s)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/nikchis/goba
 
-go 1.17
+go 1.23
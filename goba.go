@@ -4,25 +4,42 @@ package goba
 
 import (
 	"fmt"
+	"log/slog"
+	"math"
 	"math/bits"
+	"math/rand"
+	"sync"
 	"sync/atomic"
-	"unsafe"
+	"time"
 )
 
-var isLE bool
-
-func init() {
-	var x uint16 = 0xff00
-	xb := *(*[2]byte)(unsafe.Pointer(&x))
-	isLE = (xb[0] == 0x00)
-}
-
 type BitArray struct {
 	left       int64 // left boundary
 	right      int64 // right boundary
 	length     int64 // length in bits
 	concurrent bool
 	data       []uint64
+	mapped     []byte     // mmap'd backing memory of data, if any
+	tracer     *tracer    // logger of slow operations, if any
+	batch      sync.Mutex // serializes multi-word batches like Fields
+
+	dirty      *BitArray // modified regions, if tracked
+	dirtyWords int64     // words per region of dirty
+	feed       *Changefeed
+	iters      atomic.Pointer[[]*Iterator] // open iterators, if any
+	skip       *BitArray                   // nonzero words, if indexed
+	rank       atomic.Pointer[rankIndex]   // cumulative popcounts, if built
+
+	tracked     atomic.Bool   // mutations are counted, see TrackConsistency
+	gated       atomic.Bool   // writers wait for an exclusive consistent read
+	writesBegun atomic.Uint64 // mutations begun, if tracked
+	writesDone  atomic.Uint64 // mutations ended, if tracked
+}
+
+// Range of bit indices [Start, End)
+type Range struct {
+	Start int
+	End   int
 }
 
 // New returns an instantiated BitArray struct.
@@ -37,6 +54,73 @@ func New(length int, concurrent bool) *BitArray {
 	return &res
 }
 
+// NewInBuffer returns an instantiated BitArray struct using words as its
+// data without copying, e.g. memory of an arena or a mapped file.
+//
+// It panics when words are shorter than length bits. Bits of words past
+// length are cleared and the set bits already in words are kept. Writes
+// through BitArray are visible in words and the caller must not write
+// words while BitArray is in use. Growing BitArray, e.g. by MergeFrom of
+// a longer array, reallocates its data and ends the aliasing.
+func NewInBuffer(words []uint64, length int, concurrent bool) *BitArray {
+	n := (length + 63) / 64
+	if length < 0 || len(words) < n {
+		panic(fmt.Sprintf("goba: buffer of %d words is too small for %d bits", len(words), length))
+	}
+	res := BitArray{
+		length:     int64(length),
+		concurrent: concurrent,
+		data:       words[:n:n],
+	}
+	if n > 0 {
+		res.data[n-1] &= tailMask(length)
+	}
+	for i := n - 1; i > 0; i-- {
+		if res.data[i] != 0 {
+			res.right = int64(i)
+			break
+		}
+	}
+	return &res
+}
+
+// NewFromIndices returns an instantiated BitArray with bits at indices
+// set, its length is the largest index plus one. Indices are read twice,
+// for the length and for the bits. Negative indices and ones above
+// math.MaxInt-64, whose length in words would overflow, are ignored.
+func NewFromIndices(indices []int, concurrent bool) *BitArray {
+	length := 0
+	for _, index := range indices {
+		if index >= length && index <= maxInt-64 {
+			length = index + 1
+		}
+	}
+	res := New(length, concurrent)
+	for _, index := range indices {
+		if index >= 0 && index < length {
+			res.data[index>>6] |= 1 << (index & 0x3f)
+		}
+	}
+	res.right = int64(length-1) >> 6
+	if res.right < 0 {
+		res.right = 0
+	}
+	return res
+}
+
+// NewFromBools returns an instantiated BitArray of len(vals) bits with
+// bit i set when vals[i] is true
+func NewFromBools(vals []bool, concurrent bool) *BitArray {
+	res := New(len(vals), concurrent)
+	for i, v := range vals {
+		if v {
+			res.data[i>>6] |= 1 << (i & 0x3f)
+			res.right = int64(i >> 6)
+		}
+	}
+	return res
+}
+
 // Length of BitArray in bits
 func (s *BitArray) Len() int {
 	if s.concurrent {
@@ -46,6 +130,26 @@ func (s *BitArray) Len() int {
 	}
 }
 
+// Free releases the storage of BitArray, the array is empty afterwards.
+// Arrays returned by NewHugePages must be freed explicitly to be unmapped.
+//
+// Not safe for concurrent usage
+func (s *BitArray) Free() error {
+	if s == nil {
+		return nil
+	}
+	var err error
+	if s.mapped != nil {
+		err = unmap(s.mapped)
+	}
+	s.data = nil
+	s.mapped = nil
+	s.length = 0
+	s.left = 0
+	s.right = 0
+	return err
+}
+
 // Set bit at index
 func (s *BitArray) Set(index int) {
 	if s.concurrent {
@@ -60,6 +164,7 @@ func (s *BitArray) set(index int) {
 		return
 	}
 	var i int64 = int64(index >> 6)
+	s.writing(i, i)
 	s.data[i] |= (1 << (index & 0x3f))
 	if s.right < i {
 		s.right = i
@@ -67,6 +172,7 @@ func (s *BitArray) set(index int) {
 	if s.left > i {
 		s.left = i
 	}
+	s.wrote(i, i)
 }
 
 func (s *BitArray) setAtomically(index int) {
@@ -74,18 +180,147 @@ func (s *BitArray) setAtomically(index int) {
 		return
 	}
 	var i int64 = int64(index >> 6)
-	var v uint64 = atomic.LoadUint64(&s.data[i])
-	atomic.StoreUint64(&s.data[i], v|(1<<(index&0x3f)))
-	if atomic.LoadInt64(&s.right) < i {
-		atomic.StoreInt64(&s.right, i)
+	s.writing(i, i)
+	orWord(&s.data[i], 1<<(index&0x3f))
+	s.growBoundsAtomically(i)
+	s.wrote(i, i)
+}
+
+// SetChanged sets bit at index and reports whether it changed from 0 to 1,
+// atomically in concurrent mode
+func (s *BitArray) SetChanged(index int) bool {
+	if s.concurrent {
+		return s.setChangedAtomically(index)
+	} else {
+		return s.setChanged(index)
 	}
-	if atomic.LoadInt64(&s.left) > i {
-		atomic.StoreInt64(&s.left, i)
+}
+
+// TestAndSet sets bit at index and returns its previous value, atomically
+// in concurrent mode so that exactly one of concurrent callers sees false.
+// Indices outside of BitArray return false.
+func (s *BitArray) TestAndSet(index int) bool {
+	if s == nil || index < 0 || index >= s.Len() {
+		return false
+	}
+	return !s.SetChanged(index)
+}
+
+func (s *BitArray) setChanged(index int) bool {
+	if s == nil || index >= int(s.length) || index < 0 {
+		return false
+	}
+	var i int64 = int64(index >> 6)
+	var mask uint64 = 1 << (index & 0x3f)
+	if s.data[i]&mask != 0 {
+		return false
+	}
+	s.writing(i, i)
+	s.data[i] |= mask
+	if s.right < i {
+		s.right = i
+	}
+	if s.left > i {
+		s.left = i
+	}
+	s.wrote(i, i)
+	return true
+}
+
+func (s *BitArray) setChangedAtomically(index int) bool {
+	if s == nil || index >= int(atomic.LoadInt64(&s.length)) || index < 0 {
+		return false
+	}
+	var i int64 = int64(index >> 6)
+	s.writing(i, i)
+	var mask uint64 = 1 << (index & 0x3f)
+	if orWord(&s.data[i], mask)&mask != 0 {
+		s.settled()
+		return false
+	}
+	s.growBoundsAtomically(i)
+	s.wrote(i, i)
+	return true
+}
+
+// writing is called by every mutation before it changes words [lo, hi]
+func (s *BitArray) writing(lo, hi int64) {
+	if s.concurrent && s.tracked.Load() {
+		s.enterWrite()
+	}
+	if its := s.iters.Load(); its != nil {
+		for _, it := range *its {
+			it.preserve(int(lo), int(hi))
+		}
+	}
+}
+
+// wrote is called by every mutation after it changed words [lo, hi]
+func (s *BitArray) wrote(lo, hi int64) {
+	if s.dirty != nil {
+		s.markDirty(lo, hi)
+	}
+	if s.skip != nil {
+		s.markSkip(lo, hi)
+	}
+	if s.feed != nil {
+		s.feed.record(lo, hi)
+	}
+	if s.rank.Load() != nil {
+		s.rank.Store(nil)
+	}
+	s.settled()
+}
+
+// settled ends a mutation begun by writing, it is called by wrote or
+// directly when the mutation changed nothing
+func (s *BitArray) settled() {
+	if s.concurrent && s.tracked.Load() {
+		s.writesDone.Add(1)
+	}
+}
+
+// orWord sets mask bits of the word at addr and returns its previous value
+func orWord(addr *uint64, mask uint64) uint64 {
+	for {
+		old := atomic.LoadUint64(addr)
+		if old&mask == mask || atomic.CompareAndSwapUint64(addr, old, old|mask) {
+			return old
+		}
+	}
+}
+
+// andNotWord clears mask bits of the word at addr and returns its previous value
+func andNotWord(addr *uint64, mask uint64) uint64 {
+	for {
+		old := atomic.LoadUint64(addr)
+		if old&mask == 0 || atomic.CompareAndSwapUint64(addr, old, old&^mask) {
+			return old
+		}
+	}
+}
+
+// growBoundsAtomically widens left and right boundaries to include word i
+func (s *BitArray) growBoundsAtomically(i int64) {
+	for {
+		right := atomic.LoadInt64(&s.right)
+		if right >= i || atomic.CompareAndSwapInt64(&s.right, right, i) {
+			break
+		}
+	}
+	for {
+		left := atomic.LoadInt64(&s.left)
+		if left <= i || atomic.CompareAndSwapInt64(&s.left, left, i) {
+			break
+		}
 	}
 }
 
 // Set all bits to 1
 func (s *BitArray) SetAll() {
+	if t := s.tracer; t != nil {
+		defer t.trace("SetAll", time.Now(), s, nil)
+	}
 	if s.concurrent {
 		s.setAllAtomically()
 	} else {
@@ -97,30 +332,94 @@ func (s *BitArray) setAll() {
 	if s == nil {
 		return
 	}
+	s.writing(0, int64(len(s.data))-1)
 	for i := range s.data {
 		if i < len(s.data)-1 {
 			s.data[i] = 0xffffffffffffffff
 		} else {
-			s.data[i] = (1<<(s.length&0x3f) - 1)
+			s.data[i] = tailMask(int(s.length))
 		}
 	}
 	s.left = 0
 	s.right = int64(len(s.data)) - 1
+	s.wrote(0, s.right)
 }
 
 func (s *BitArray) setAllAtomically() {
 	if s == nil {
 		return
 	}
+	s.writing(0, int64(len(s.data))-1)
 	for i := range s.data {
 		if i < len(s.data)-1 {
 			atomic.StoreUint64(&s.data[i], 0xffffffffffffffff)
 		} else {
-			atomic.StoreUint64(&s.data[i], (1<<(atomic.LoadInt64(&s.length)&0x3f) - 1))
+			atomic.StoreUint64(&s.data[i], tailMask(int(atomic.LoadInt64(&s.length))))
 		}
 	}
 	atomic.StoreInt64(&s.left, 0)
 	atomic.StoreInt64(&s.right, int64(len(s.data))-1)
+	s.wrote(0, int64(len(s.data))-1)
+}
+
+// FlipRange inverts bits [from, to) clamped to length
+func (s *BitArray) FlipRange(from, to int) {
+	s.applyRange(from, to, func(v, mask uint64) uint64 { return v ^ mask })
+}
+
+// SetRange sets bits [from, to) clamped to length
+func (s *BitArray) SetRange(from, to int) {
+	s.applyRange(from, to, func(v, mask uint64) uint64 { return v | mask })
+}
+
+// RemoveRange removes bits [from, to) clamped to length
+func (s *BitArray) RemoveRange(from, to int) {
+	s.applyRange(from, to, func(v, mask uint64) uint64 { return v &^ mask })
+}
+
+// applyRange replaces each word overlapping bits [from, to), clamped to
+// length, with op of it and the mask of its bits within the range.
+// Interior words get a full mask, the boundary ones a partial mask.
+func (s *BitArray) applyRange(from, to int, op func(v, mask uint64) uint64) {
+	if s == nil {
+		return
+	}
+	if from < 0 {
+		from = 0
+	}
+	if n := s.Len(); to > n {
+		to = n
+	}
+	if from >= to {
+		return
+	}
+	lo, hi := from>>6, (to-1)>>6
+	s.writing(int64(lo), int64(hi))
+	for i := lo; i <= hi; i++ {
+		mask := ^uint64(0)
+		if i == lo {
+			mask &= ^uint64(0) << (from & 0x3f)
+		}
+		if i == hi {
+			mask &= tailMask(to)
+		}
+		if !s.concurrent {
+			s.data[i] = op(s.data[i], mask)
+			continue
+		}
+		for {
+			old := atomic.LoadUint64(&s.data[i])
+			if atomic.CompareAndSwapUint64(&s.data[i], old, op(old, mask)) {
+				break
+			}
+		}
+	}
+	if s.concurrent {
+		s.growBoundsAtomically(int64(hi))
+	} else if s.right < int64(hi) {
+		s.right = int64(hi)
+	}
+	s.wrote(int64(lo), int64(hi))
 }
 
 // Remove bit at index
@@ -137,6 +436,7 @@ func (s *BitArray) remove(index int) {
 		return
 	}
 	var i int64 = int64(index >> 6)
+	s.writing(i, i)
 	s.data[i] &^= (1 << (index & 0x3f))
 	if s.right < i {
 		s.right = i
@@ -144,6 +444,7 @@ func (s *BitArray) remove(index int) {
 	if s.left > i {
 		s.left = i
 	}
+	s.wrote(i, i)
 }
 
 func (s *BitArray) removeAtomically(index int) {
@@ -151,18 +452,102 @@ func (s *BitArray) removeAtomically(index int) {
 		return
 	}
 	var i int64 = int64(index >> 6)
-	var v uint64 = atomic.LoadUint64(&s.data[i])
-	atomic.StoreUint64(&s.data[i], v&^(1<<(index&0x3f)))
-	if atomic.LoadInt64(&s.right) < i {
-		atomic.StoreInt64(&s.right, i)
+	s.writing(i, i)
+	andNotWord(&s.data[i], 1<<(index&0x3f))
+	s.growBoundsAtomically(i)
+	s.wrote(i, i)
+}
+
+// RemoveChanged removes bit at index and reports whether it changed
+// from 1 to 0, atomically in concurrent mode
+func (s *BitArray) RemoveChanged(index int) bool {
+	if s.concurrent {
+		return s.removeChangedAtomically(index)
+	} else {
+		return s.removeChanged(index)
+	}
+}
+
+// TestAndClear removes bit at index and returns its previous value,
+// atomically in concurrent mode so that exactly one of concurrent callers
+// sees true. Indices outside of BitArray return false.
+func (s *BitArray) TestAndClear(index int) bool {
+	return s.RemoveChanged(index)
+}
+
+// CompareAndSwapBit sets bit at index to new if it is old and reports
+// whether it was, atomically in concurrent mode. Indices outside of
+// BitArray return false.
+func (s *BitArray) CompareAndSwapBit(index int, old, new bool) bool {
+	if s == nil || index < 0 || index >= s.Len() {
+		return false
+	}
+	i := int64(index >> 6)
+	var mask uint64 = 1 << (index & 0x3f)
+	if (s.word(int(i))&mask != 0) != old {
+		return false
+	}
+	if old == new {
+		return true
+	}
+	s.writing(i, i)
+	if s.concurrent {
+		for {
+			w := atomic.LoadUint64(&s.data[i])
+			if (w&mask != 0) != old {
+				s.settled()
+				return false
+			}
+			if atomic.CompareAndSwapUint64(&s.data[i], w, w^mask) {
+				break
+			}
+		}
+		s.growBoundsAtomically(i)
+	} else {
+		s.data[i] ^= mask
+		if s.right < i {
+			s.right = i
+		}
+	}
+	s.wrote(i, i)
+	return true
+}
+
+func (s *BitArray) removeChanged(index int) bool {
+	if s == nil || index >= int(s.length) || index < 0 {
+		return false
+	}
+	var i int64 = int64(index >> 6)
+	var mask uint64 = 1 << (index & 0x3f)
+	if s.data[i]&mask == 0 {
+		return false
+	}
+	s.writing(i, i)
+	s.data[i] &^= mask
+	s.wrote(i, i)
+	return true
+}
+
+func (s *BitArray) removeChangedAtomically(index int) bool {
+	if s == nil || index >= int(atomic.LoadInt64(&s.length)) || index < 0 {
+		return false
 	}
-	if atomic.LoadInt64(&s.left) > i {
-		atomic.StoreInt64(&s.left, i)
+	var i int64 = int64(index >> 6)
+	s.writing(i, i)
+	var mask uint64 = 1 << (index & 0x3f)
+	if andNotWord(&s.data[i], mask)&mask == 0 {
+		s.settled()
+		return false
 	}
+	s.wrote(i, i)
+	return true
 }
 
 // Remove all bits
 func (s *BitArray) RemoveAll() {
+	if t := s.tracer; t != nil {
+		defer t.trace("RemoveAll", time.Now(), s, nil)
+	}
 	if s.concurrent {
 		s.removeAllAtomically()
 	} else {
@@ -174,22 +559,30 @@ func (s *BitArray) removeAll() {
 	if s == nil {
 		return
 	}
-	for i := range s.data {
-		s.data[i] = 0x0000000000000000
+	s.writing(0, int64(len(s.data))-1)
+	if s.mapped == nil || releasePages(s.mapped) != nil {
+		for i := range s.data {
+			s.data[i] = 0x0000000000000000
+		}
 	}
 	s.left = 0
 	s.right = 0
+	s.wrote(0, int64(len(s.data))-1)
 }
 
 func (s *BitArray) removeAllAtomically() {
 	if s == nil {
 		return
 	}
-	for i := range s.data {
-		atomic.StoreUint64(&s.data[i], 0x0000000000000000)
+	s.writing(0, int64(len(s.data))-1)
+	if s.mapped == nil || releasePages(s.mapped) != nil {
+		for i := range s.data {
+			atomic.StoreUint64(&s.data[i], 0x0000000000000000)
+		}
 	}
 	atomic.StoreInt64(&s.left, 0)
 	atomic.StoreInt64(&s.right, 0)
+	s.wrote(0, int64(len(s.data))-1)
 }
 
 // Get bit value at index
@@ -216,8 +609,346 @@ func (s *BitArray) getAtomically(index int) bool {
 	return ((atomic.LoadUint64(&s.data[index>>6]) >> ((index) & 0x3f)) & 1) == 1
 }
 
+// GetOK returns bit value at index and whether index is within BitArray,
+// value is false for indices outside of it
+func (s *BitArray) GetOK(index int) (value bool, ok bool) {
+	if s == nil || index >= s.Len() || index < 0 {
+		return false, false
+	}
+	return s.Get(index), true
+}
+
+// GetMany appends bit values at indices to dst and returns the extended
+// slice, indices outside of BitArray read as false. The length is read
+// once and a run of indices in the same word loads the word once.
+func (s *BitArray) GetMany(indices []int, dst []bool) []bool {
+	var n int
+	if s != nil {
+		n = s.Len()
+	}
+	w, cur := uint64(0), -1
+	for _, index := range indices {
+		if uint(index) >= uint(n) {
+			dst = append(dst, false)
+			continue
+		}
+		if i := index >> 6; i != cur {
+			w, cur = s.word(i), i
+		}
+		dst = append(dst, w>>(index&0x3f)&1 == 1)
+	}
+	return dst
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// tailMask returns mask of bits within length in the last word
+func tailMask(length int) uint64 {
+	if length&0x3f == 0 {
+		return 0xffffffffffffffff
+	}
+	return 1<<(length&0x3f) - 1
+}
+
+// word returns the data word at i, loaded atomically in concurrent mode
+func (s *BitArray) word(i int) uint64 {
+	if s.concurrent {
+		return atomic.LoadUint64(&s.data[i])
+	}
+	return s.data[i]
+}
+
+// bitsAt returns n bits, 1 to 64, starting at from as an integer where
+// bit j is the bit at from+j. Bits beyond the last word read as 0.
+func (s *BitArray) bitsAt(from, n int) uint64 {
+	i, off := from>>6, from&0x3f
+	var v uint64
+	if i < len(s.data) {
+		v = s.word(i) >> off
+	}
+	if off != 0 && off+n > 64 && i+1 < len(s.data) {
+		v |= s.word(i+1) << (64 - off)
+	}
+	if n < 64 {
+		v &= 1<<n - 1
+	}
+	return v
+}
+
+// putBits writes n bits, 1 to 64, of v starting at from so that bit j of v
+// goes to from+j, the inverse of bitsAt. Bits must be within the last word.
+func (s *BitArray) putBits(from, n int, v uint64) {
+	mask := ^uint64(0)
+	if n < 64 {
+		mask = 1<<n - 1
+	}
+	v &= mask
+	i, off := from>>6, from&0x3f
+	hi := i
+	if off != 0 && off+n > 64 {
+		hi = i + 1
+	}
+	s.writing(int64(i), int64(hi))
+	s.storeBits(from, n, v)
+	if s.concurrent {
+		s.growBoundsAtomically(int64(hi))
+	} else if s.right < int64(hi) {
+		s.right = int64(hi)
+	}
+	s.wrote(int64(i), int64(hi))
+}
+
+// storeBits is putBits without mutation hooks and bounds, for callers
+// that wrap many writes in a single span
+func (s *BitArray) storeBits(from, n int, v uint64) {
+	mask := ^uint64(0)
+	if n < 64 {
+		mask = 1<<n - 1
+	}
+	v &= mask
+	i, off := from>>6, from&0x3f
+	s.putWord(i, mask<<off, v<<off)
+	if off != 0 && off+n > 64 {
+		s.putWord(i+1, mask>>(64-off), v>>(64-off))
+	}
+}
+
+// putWord replaces mask bits of the word at i with those of v
+func (s *BitArray) putWord(i int, mask, v uint64) {
+	if !s.concurrent {
+		s.data[i] = s.data[i]&^mask | v&mask
+		return
+	}
+	for {
+		old := atomic.LoadUint64(&s.data[i])
+		if atomic.CompareAndSwapUint64(&s.data[i], old, old&^mask|v&mask) {
+			return
+		}
+	}
+}
+
+// lastWord returns the index of the last word that may be nonzero
+func (s *BitArray) lastWord() int {
+	var right int64
+	if s.concurrent {
+		right = atomic.LoadInt64(&s.right)
+	} else {
+		right = s.right
+	}
+	if int(right) >= len(s.data) {
+		return len(s.data) - 1
+	}
+	return int(right)
+}
+
+// NextSet returns index of the first set bit at or after from, ok is
+// false when there is none
+func (s *BitArray) NextSet(from int) (int, bool) {
+	i := s.nextSet(from)
+	return i, i >= 0
+}
+
+// nextSet returns index of the first set bit at or after from, or -1
+func (s *BitArray) nextSet(from int) int {
+	if from < 0 {
+		from = 0
+	}
+	if from >= s.Len() {
+		return -1
+	}
+	i := from >> 6
+	if v := s.word(i) >> (from & 0x3f); v != 0 {
+		return from + bits.TrailingZeros64(v)
+	}
+	if s.skip != nil {
+		return s.nextSetIndexed(i + 1)
+	}
+	for i, last := i+1, s.lastWord(); i <= last; i++ {
+		if v := s.word(i); v != 0 {
+			return i<<6 + bits.TrailingZeros64(v)
+		}
+	}
+	return -1
+}
+
+// PrevSet returns index of the last set bit at or before from, ok is
+// false when there is none
+func (s *BitArray) PrevSet(from int) (int, bool) {
+	i := s.prevSet(from)
+	return i, i >= 0
+}
+
+// prevSet returns index of the last set bit at or before from, or -1
+func (s *BitArray) prevSet(from int) int {
+	if n := s.Len(); from >= n {
+		from = n - 1
+	}
+	if from < 0 {
+		return -1
+	}
+	i := from >> 6
+	if last := s.lastWord(); i > last {
+		i, from = last, last<<6+63
+	}
+	if v := s.word(i) << (63 - from&0x3f); v != 0 {
+		return from - bits.LeadingZeros64(v)
+	}
+	for i--; i >= 0; i-- {
+		if v := s.word(i); v != 0 {
+			return i<<6 + 63 - bits.LeadingZeros64(v)
+		}
+	}
+	return -1
+}
+
+// MinSet returns index of the lowest set bit, ok is false when none is set
+func (s *BitArray) MinSet() (int, bool) {
+	return s.NextSet(0)
+}
+
+// MaxSet returns index of the highest set bit, ok is false when none is
+// set. The search starts at the last word that may be nonzero.
+func (s *BitArray) MaxSet() (int, bool) {
+	return s.PrevSet(maxInt)
+}
+
+// Indices returns indices of set bits in ascending order
+func (s *BitArray) Indices() []int {
+	return s.AppendIndices(make([]int, 0, s.Count()))
+}
+
+// AppendIndices appends indices of set bits in ascending order to dst and
+// returns the extended slice
+func (s *BitArray) AppendIndices(dst []int) []int {
+	for i, last := 0, s.lastWord(); i <= last; i++ {
+		for v := s.word(i); v != 0; v &= v - 1 {
+			dst = append(dst, i<<6+bits.TrailingZeros64(v))
+		}
+	}
+	return dst
+}
+
+// ToBools returns bit values as a boolean slice of length bits
+func (s *BitArray) ToBools() []bool {
+	return s.AppendBools(make([]bool, 0, s.Len()))
+}
+
+// AppendBools appends bit values of length bits to dst and returns the
+// extended slice
+func (s *BitArray) AppendBools(dst []bool) []bool {
+	n := s.Len()
+	for i := 0; i < n; i += 64 {
+		v := s.word(i >> 6)
+		for j := i; j < n && j < i+64; j++ {
+			dst = append(dst, v&1 == 1)
+			v >>= 1
+		}
+	}
+	return dst
+}
+
+// NextClear returns index of the first clear bit at or after from within
+// length, ok is false when there is none. Full words are skipped at once.
+func (s *BitArray) NextClear(from int) (int, bool) {
+	i := s.nextClear(from)
+	return i, i >= 0
+}
+
+// nextClear returns index of the first clear bit at or after from within
+// length, or -1
+func (s *BitArray) nextClear(from int) int {
+	if from < 0 {
+		from = 0
+	}
+	n := s.Len()
+	if from >= n {
+		return -1
+	}
+	i := from >> 6
+	if v := ^s.word(i) >> (from & 0x3f); v != 0 {
+		if r := from + bits.TrailingZeros64(v); r < n {
+			return r
+		}
+		return -1
+	}
+	for i := i + 1; i < len(s.data); i++ {
+		if v := ^s.word(i); v != 0 {
+			if r := i<<6 + bits.TrailingZeros64(v); r < n {
+				return r
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// CountRange returns count of set bits in [from, to) clamped to length
+func (s *BitArray) CountRange(from, to int) int {
+	if from < 0 {
+		from = 0
+	}
+	if n := s.Len(); to > n {
+		to = n
+	}
+	if from >= to || from>>6 > s.lastWord() {
+		return 0
+	}
+	first, last := from>>6, (to-1)>>6
+	lo := ^uint64(0) << (from & 0x3f)
+	hi := ^uint64(0) >> (63 - ((to - 1) & 0x3f))
+	if first == last {
+		return bits.OnesCount64(s.word(first) & lo & hi)
+	}
+	cnt := bits.OnesCount64(s.word(first) & lo)
+	for i := first + 1; i < last; i++ {
+		cnt += bits.OnesCount64(s.word(i))
+	}
+	return cnt + bits.OnesCount64(s.word(last)&hi)
+}
+
+// AnyInRange reports whether any bit in [from, to) clamped to length is set
+func (s *BitArray) AnyInRange(from, to int) bool {
+	if n := s.Len(); to > n {
+		to = n
+	}
+	i := s.nextSet(from)
+	return i >= 0 && i < to
+}
+
+// AllInRange reports whether all bits in [from, to) clamped to length are
+// set, true for an empty range
+func (s *BitArray) AllInRange(from, to int) bool {
+	if n := s.Len(); to > n {
+		to = n
+	}
+	if from < 0 {
+		from = 0
+	}
+	if from >= to {
+		return true
+	}
+	i := s.nextClear(from)
+	return i < 0 || i >= to
+}
+
+// NoneInRange reports whether no bit in [from, to) clamped to length is set
+func (s *BitArray) NoneInRange(from, to int) bool {
+	return !s.AnyInRange(from, to)
+}
+
 // Count of nonzero bits
-func (s *BitArray) Count() int {
+func (s *BitArray) Count() (cnt int) {
+	if t := s.tracer; t != nil {
+		defer t.trace("Count", time.Now(), s, func() []slog.Attr {
+			return []slog.Attr{slog.Int("count", cnt)}
+		})
+	}
+	switch PopcountStrategy(popcount.Load()) {
+	case PopcountTable:
+		return s.countTable()
+	case PopcountNative:
+		return s.countNative()
+	}
 	if s.concurrent {
 		return s.count12Atomically()
 	} else {
@@ -225,6 +956,83 @@ func (s *BitArray) Count() int {
 	}
 }
 
+// CountFrom returns count of set bits at or after index
+func (s *BitArray) CountFrom(index int) int {
+	return s.CountRange(index, s.Len())
+}
+
+// CountUpTo returns count of set bits before index,
+// the rank of index
+func (s *BitArray) CountUpTo(index int) int {
+	return s.CountRange(0, index)
+}
+
+// EstimateCount returns count of set bits estimated from samples randomly
+// chosen distinct words and the half-width of its 95% confidence interval, without
+// a full scan. With samples at least the number of words it counts exactly.
+func (s *BitArray) EstimateCount(samples int) (estimate int, errBound float64) {
+	n := len(s.data)
+	if samples >= n {
+		return s.Count(), 0
+	}
+	if samples <= 0 {
+		return 0, float64(s.Len())
+	}
+	// distinct words by Floyd's algorithm, sampling without replacement
+	// is what the finite population correction below assumes
+	picked := make(map[int]struct{}, samples)
+	var sum, sumSq float64
+	for j := n - samples; j < n; j++ {
+		i := rand.Intn(j + 1)
+		if _, ok := picked[i]; ok {
+			i = j
+		}
+		picked[i] = struct{}{}
+		c := float64(bits.OnesCount64(s.word(i)))
+		sum += c
+		sumSq += c * c
+	}
+	mean := sum / float64(samples)
+	var variance float64
+	if samples > 1 {
+		variance = (sumSq - sum*mean) / float64(samples-1)
+	}
+	// standard error of the total with the finite population correction
+	se := float64(n) * math.Sqrt(variance/float64(samples)*float64(n-samples)/float64(n-1))
+	return int(math.Round(mean * float64(n))), 1.96 * se
+}
+
+// ReservoirSample returns k set bits chosen uniformly at random with rng,
+// or all of them when fewer are set, in a single pass without knowing
+// their count. The order of the result is random. A nil rng uses the
+// default source.
+func (s *BitArray) ReservoirSample(rng *rand.Rand, k int) []int {
+	if k <= 0 {
+		return nil
+	}
+	intn := rand.Intn
+	if rng != nil {
+		intn = rng.Intn
+	}
+	// k may be far above the number of set bits, res grows as they are met
+	var res []int
+	var seen int
+	for i := s.nextSet(0); i >= 0; i = s.nextSet(i + 1) {
+		seen++
+		if len(res) < k {
+			res = append(res, i)
+		} else if j := intn(seen); j < k {
+			res[j] = i
+		}
+	}
+	// the reservoir is filled in ascending order
+	for i := len(res) - 1; i > 0; i-- {
+		j := intn(i + 1)
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
 func (s *BitArray) count12() int {
 	var cnt uint64
 	for _, v := range s.data {
@@ -299,8 +1107,316 @@ func (s *BitArray) sprint() string {
 	return res
 }
 
+// Clone returns a copy of BitArray in the same mode
+func (s *BitArray) Clone() *BitArray {
+	res := New(s.Len(), s.concurrent)
+	for i := range res.data {
+		res.data[i] = s.word(i)
+	}
+	res.right = int64(s.lastWord())
+	if res.right < 0 {
+		res.right = 0
+	}
+	return res
+}
+
+// CopyFrom replaces content and length of BitArray with those of src,
+// reusing data when its capacity is enough. In concurrent mode the length
+// cannot change and a different one fails with ErrLengthMismatch.
+func (s *BitArray) CopyFrom(src *BitArray) error {
+	length := src.Len()
+	n := (length + 63) / 64
+	if s.concurrent && length != s.Len() {
+		return fmt.Errorf("%w: copy of %d bits into %d in concurrent mode", ErrLengthMismatch, length, s.Len())
+	}
+	if n > cap(s.data) {
+		data := make([]uint64, n)
+		for i := range data {
+			data[i] = src.word(i)
+		}
+		s.replace(data, length)
+		return nil
+	}
+	old := len(s.data)
+	s.writing(0, int64(old)-1)
+	if n < old {
+		clear(s.data[n:old])
+	}
+	s.data = s.data[:n]
+	var right int64
+	for i := range s.data {
+		v := src.word(i)
+		if v != 0 {
+			right = int64(i)
+		}
+		if s.concurrent {
+			atomic.StoreUint64(&s.data[i], v)
+		} else {
+			s.data[i] = v
+		}
+	}
+	if s.concurrent {
+		atomic.StoreInt64(&s.left, 0)
+		atomic.StoreInt64(&s.right, right)
+	} else {
+		s.length = int64(length)
+		s.left = 0
+		s.right = right
+		if s.dirty != nil && n != old {
+			s.TrackDirty(int(s.dirtyWords))
+		}
+	}
+	s.wrote(0, int64(n)-1)
+	return nil
+}
+
+// DiffCount returns count of bits that differ from since, a previously
+// captured copy of BitArray, in a single pass without allocations.
+// Bits beyond the end of the shorter array count as 0.
+func (s *BitArray) DiffCount(since *BitArray) int {
+	a, b := s, since
+	if len(a.data) < len(b.data) {
+		a, b = b, a
+	}
+	var cnt int
+	for i := range b.data {
+		cnt += bits.OnesCount64(a.word(i) ^ b.word(i))
+	}
+	for i := len(b.data); i < len(a.data); i++ {
+		cnt += bits.OnesCount64(a.word(i))
+	}
+	return cnt
+}
+
+// HammingDistance returns count of bits that differ between BitArray and
+// ba, the popcount of their XOR without allocating. Bits beyond the end
+// of the shorter array count as 0.
+func (s *BitArray) HammingDistance(ba *BitArray) int {
+	return s.DiffCount(ba)
+}
+
+// Equal reports whether BitArray and ba have the same length and bits
+func (s *BitArray) Equal(ba *BitArray) bool {
+	if s == nil || ba == nil {
+		return s == ba
+	}
+	if s.Len() != ba.Len() {
+		return false
+	}
+	for i := range s.data {
+		if s.word(i) != ba.word(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare returns -1, 0 or 1 as BitArray orders before, equal to or after
+// ba. Arrays are ordered as strings of bits from index 0 on where 0 comes
+// before 1, so the first differing index decides and an array ordering
+// before all of its extensions decides the rest by length.
+func (s *BitArray) Compare(ba *BitArray) int {
+	n := s.Len()
+	if l := ba.Len(); l < n {
+		n = l
+	}
+	words := (n + 63) / 64
+	for i := 0; i < words; i++ {
+		diff := s.word(i) ^ ba.word(i)
+		if i == words-1 {
+			diff &= tailMask(n)
+		}
+		if diff != 0 {
+			if s.word(i)&(diff&-diff) != 0 {
+				return 1
+			}
+			return -1
+		}
+	}
+	switch l, r := s.Len(), ba.Len(); {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+// IsSubsetOf reports whether every bit set in BitArray is set in ba,
+// stopping at the first word that is not
+func (s *BitArray) IsSubsetOf(ba *BitArray) bool {
+	for i, last := 0, s.lastWord(); i <= last; i++ {
+		v := s.word(i)
+		if v == 0 {
+			continue
+		}
+		if i >= len(ba.data) || v&^ba.word(i) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSupersetOf reports whether every bit set in ba is set in BitArray
+func (s *BitArray) IsSupersetOf(ba *BitArray) bool {
+	return ba.IsSubsetOf(s)
+}
+
+// CountAnd returns count of bits set in both BitArray and ba without
+// allocating
+func (s *BitArray) CountAnd(ba *BitArray) int {
+	n := len(s.data)
+	if len(ba.data) < n {
+		n = len(ba.data)
+	}
+	var cnt int
+	for i := 0; i < n; i++ {
+		cnt += bits.OnesCount64(s.word(i) & ba.word(i))
+	}
+	return cnt
+}
+
+// CountOr returns count of bits set in either BitArray or ba without
+// allocating
+func (s *BitArray) CountOr(ba *BitArray) int {
+	a, b := s, ba
+	if len(a.data) < len(b.data) {
+		a, b = b, a
+	}
+	var cnt int
+	for i := range b.data {
+		cnt += bits.OnesCount64(a.word(i) | b.word(i))
+	}
+	for i := len(b.data); i < len(a.data); i++ {
+		cnt += bits.OnesCount64(a.word(i))
+	}
+	return cnt
+}
+
+// grow extends BitArray to length bits, it never shrinks.
+// Storage is reallocated when needed, which is not safe for concurrent usage.
+func (s *BitArray) grow(length int) {
+	if length <= s.Len() {
+		return
+	}
+	s.writing(0, int64(len(s.data))-1)
+	if words := (length + 63) / 64; words > len(s.data) {
+		data := make([]uint64, words)
+		for i := range s.data {
+			data[i] = s.word(i)
+		}
+		if s.mapped != nil {
+			unmap(s.mapped)
+			s.mapped = nil
+		}
+		s.data = data
+		if s.dirty != nil {
+			s.dirty.grow(int((int64(words) + s.dirtyWords - 1) / s.dirtyWords))
+		}
+	}
+	if s.concurrent {
+		atomic.StoreInt64(&s.length, int64(length))
+	} else {
+		s.length = int64(length)
+	}
+	s.wrote(0, int64(len(s.data))-1)
+}
+
+// orFrom sets all bits of ba in BitArray, growing it to the length of ba,
+// and reports whether any bit changed
+func (s *BitArray) orFrom(ba *BitArray) bool {
+	s.grow(ba.Len())
+	var changed bool
+	var lo, hi int64 = -1, -1
+	last := ba.lastWord()
+	s.writing(0, int64(last))
+	for i := 0; i <= last; i++ {
+		v := ba.word(i)
+		if v == 0 {
+			continue
+		}
+		if s.concurrent {
+			if orWord(&s.data[i], v)&v == v {
+				continue
+			}
+		} else {
+			if s.data[i]&v == v {
+				continue
+			}
+			s.data[i] |= v
+		}
+		if lo < 0 {
+			lo = int64(i)
+		}
+		hi = int64(i)
+		changed = true
+	}
+	if !changed {
+		s.settled()
+		return false
+	}
+	if s.concurrent {
+		s.growBoundsAtomically(hi)
+	} else if s.right < hi {
+		s.right = hi
+	}
+	s.wrote(lo, hi)
+	return true
+}
+
+// combineFrom replaces each word of BitArray with op of it and the word of
+// ba, words past the end of ba read as 0 and bits past the length stay 0
+func (s *BitArray) combineFrom(ba *BitArray, op func(a, b uint64) uint64) {
+	n := len(s.data)
+	if n == 0 {
+		return
+	}
+	s.writing(0, int64(n)-1)
+	tail := tailMask(s.Len())
+	var hi int64 = -1
+	for i := range s.data {
+		var v uint64
+		if i < len(ba.data) {
+			v = ba.word(i)
+		}
+		mask := ^uint64(0)
+		if i == n-1 {
+			mask = tail
+		}
+		var res uint64
+		if s.concurrent {
+			for {
+				old := atomic.LoadUint64(&s.data[i])
+				res = op(old, v) & mask
+				if atomic.CompareAndSwapUint64(&s.data[i], old, res) {
+					break
+				}
+			}
+		} else {
+			res = op(s.data[i], v) & mask
+			s.data[i] = res
+		}
+		if res != 0 {
+			hi = int64(i)
+		}
+	}
+	if hi >= 0 {
+		if s.concurrent {
+			s.growBoundsAtomically(hi)
+		} else if s.right < hi {
+			s.right = hi
+		}
+	}
+	s.wrote(0, int64(n)-1)
+}
+
 // Return union of BitArrays
-func (s *BitArray) UnifyWith(ba *BitArray) *BitArray {
+func (s *BitArray) UnifyWith(ba *BitArray) (res *BitArray) {
+	if t := s.tracer; t != nil {
+		defer t.trace("UnifyWith", time.Now(), s, func() []slog.Attr {
+			return []slog.Attr{slog.Int("other_length", traceLen(ba)), slog.Int("count", traceCount(res))}
+		})
+	}
 	if s.concurrent || ba.concurrent {
 		return s.unifyWithAtomically(ba)
 	} else {
@@ -372,8 +1488,41 @@ func (s *BitArray) unifyWithAtomically(ba *BitArray) *BitArray {
 	return res
 }
 
+// MergeFrom sets all bits of ba in BitArray, growing it to the length of
+// ba when longer, without allocating otherwise.
+//
+// The merge is a grow-only set CRDT join: bits are never cleared, merging
+// the same state again changes nothing and the order of merges does not
+// matter, so replicas gossiping states converge. Growing reallocates data
+// and is not safe for concurrent usage, merges of equal lengths are.
+func (s *BitArray) MergeFrom(ba *BitArray) {
+	if s == nil || ba == nil {
+		return
+	}
+	s.orFrom(ba)
+}
+
+// IntersectInPlace clears bits of BitArray not set in ba without
+// allocating, bits beyond the length of ba are cleared
+func (s *BitArray) IntersectInPlace(ba *BitArray) {
+	if t := s.tracer; t != nil {
+		defer t.trace("IntersectInPlace", time.Now(), s, func() []slog.Attr {
+			return []slog.Attr{slog.Int("other_length", traceLen(ba)), slog.Int("count", s.Count())}
+		})
+	}
+	if s == nil || ba == nil {
+		return
+	}
+	s.combineFrom(ba, func(a, b uint64) uint64 { return a & b })
+}
+
 // Return intersection of BitArrays
-func (s *BitArray) IntersectWith(ba *BitArray) *BitArray {
+func (s *BitArray) IntersectWith(ba *BitArray) (res *BitArray) {
+	if t := s.tracer; t != nil {
+		defer t.trace("IntersectWith", time.Now(), s, func() []slog.Attr {
+			return []slog.Attr{slog.Int("other_length", traceLen(ba)), slog.Int("count", traceCount(res))}
+		})
+	}
 	if s.concurrent {
 		return s.intersectWithAtomically(ba)
 	} else {
@@ -402,9 +1551,7 @@ func (s *BitArray) intersectWith(ba *BitArray) *BitArray {
 	} else {
 		right = s.right
 	}
-	for i := left; i <= right && i < int64(len(res.data)); i++ {
-		res.data[i] = s.data[i] & ba.data[i]
-	}
+	intersectInto(res, s, ba, left, right, false)
 	res.left = left
 	res.right = right
 
@@ -432,17 +1579,117 @@ func (s *BitArray) intersectWithAtomically(ba *BitArray) *BitArray {
 	} else {
 		right = atomic.LoadInt64(&s.right)
 	}
-	for i := left; i <= right && i < int64(len(res.data)); i++ {
-		res.data[i] = atomic.LoadUint64(&s.data[i]) & atomic.LoadUint64(&ba.data[i])
-	}
+	intersectInto(res, s, ba, left, right, true)
 	res.left = left
 	res.right = right
 
 	return res
 }
 
+// Return difference of BitArrays, bits of BitArray not set in ba
+func (s *BitArray) DifferenceWith(ba *BitArray) (res *BitArray) {
+	if t := s.tracer; t != nil {
+		defer t.trace("DifferenceWith", time.Now(), s, func() []slog.Attr {
+			return []slog.Attr{slog.Int("other_length", traceLen(ba)), slog.Int("count", traceCount(res))}
+		})
+	}
+	if s == nil || ba == nil {
+		return nil
+	}
+	atomically := s.concurrent || ba.concurrent
+	res = New(s.Len(), s.concurrent)
+	right := int64(s.lastWord())
+	for i := int64(0); i <= right; i++ {
+		v := loadWord(s, i, atomically)
+		if v != 0 && i < int64(len(ba.data)) {
+			v &^= loadWord(ba, i, atomically)
+		}
+		res.data[i] = v
+	}
+	if right > 0 {
+		res.right = right
+	}
+	return res
+}
+
+// Not returns complement of BitArray within its length
+func (s *BitArray) Not() *BitArray {
+	if s == nil {
+		return nil
+	}
+	res := New(s.Len(), s.concurrent)
+	n := len(res.data)
+	for i := range res.data {
+		res.data[i] = ^s.word(i)
+	}
+	if n > 0 {
+		res.data[n-1] &= tailMask(res.Len())
+		res.right = int64(res.lastIndex() >> 6)
+		if res.right < 0 {
+			res.right = 0
+		}
+	}
+	return res
+}
+
+// intersectSamples is the number of words sampled to pick
+// the intersection strategy
+const intersectSamples = 32
+
+// intersectInto stores a & b of words [left, right] in res. When sampling
+// shows one operand much sparser than the other, only its nonzero words
+// are probed in the denser one instead of scanning both.
+func intersectInto(res, a, b *BitArray, left, right int64, atomically bool) {
+	if right >= int64(len(res.data)) {
+		right = int64(len(res.data)) - 1
+	}
+	if left > right {
+		return
+	}
+	na, nb := sampleNonzero(a, left, right, atomically), sampleNonzero(b, left, right, atomically)
+	if na > nb {
+		a, b, na, nb = b, a, nb, na
+	}
+	if 4*na >= nb {
+		for i := left; i <= right; i++ {
+			res.data[i] = loadWord(a, i, atomically) & loadWord(b, i, atomically)
+		}
+		return
+	}
+	for i := left; i <= right; i++ {
+		if v := loadWord(a, i, atomically); v != 0 {
+			res.data[i] = v & loadWord(b, i, atomically)
+		}
+	}
+}
+
+// sampleNonzero returns count of nonzero words among evenly spaced
+// samples of words [left, right]
+func sampleNonzero(s *BitArray, left, right int64, atomically bool) int {
+	step := (right-left)/intersectSamples + 1
+	var n int
+	for i := left; i <= right; i += step {
+		if loadWord(s, i, atomically) != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func loadWord(s *BitArray, i int64, atomically bool) uint64 {
+	if atomically {
+		return atomic.LoadUint64(&s.data[i])
+	}
+	return s.data[i]
+}
+
 // Check for intersection with BitArray
-func (s *BitArray) HasIntersectionWith(ba *BitArray) bool {
+func (s *BitArray) HasIntersectionWith(ba *BitArray) (res bool) {
+	if t := s.tracer; t != nil {
+		defer t.trace("HasIntersectionWith", time.Now(), s, func() []slog.Attr {
+			return []slog.Attr{slog.Int("other_length", traceLen(ba)), slog.Bool("result", res)}
+		})
+	}
 	return s.hasIntersectionWith(ba)
 }
 
@@ -471,3 +1718,114 @@ func (s *BitArray) hasIntersectionWith(ba *BitArray) bool {
 
 	return false
 }
+
+// FirstIntersecting returns index of the first of candidates sharing any
+// bit with query, ok is false when none does. Words outside the set bits
+// of query are skipped and each candidate is left on its first common word.
+func FirstIntersecting(query *BitArray, candidates []*BitArray) (index int, ok bool) {
+	if query == nil {
+		return -1, false
+	}
+	first := query.nextSet(0)
+	if first < 0 {
+		return -1, false
+	}
+	lo, hi := first>>6, query.lastWord()
+	for n, c := range candidates {
+		if c == nil {
+			continue
+		}
+		last := hi
+		if l := c.lastWord(); l < last {
+			last = l
+		}
+		for i := lo; i <= last; i++ {
+			if query.word(i)&c.word(i) != 0 {
+				return n, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// Union returns union of BitArrays built in a single pass over words, its
+// length is the longest one and its mode the one of the first array.
+// Nil arrays are skipped.
+func Union(bas ...*BitArray) *BitArray {
+	var length, last int = 0, -1
+	var concurrent, seen bool
+	for _, ba := range bas {
+		if ba == nil {
+			continue
+		}
+		if !seen {
+			concurrent, seen = ba.concurrent, true
+		}
+		if n := ba.Len(); n > length {
+			length = n
+		}
+		if l := ba.lastWord(); l > last {
+			last = l
+		}
+	}
+	res := New(length, concurrent)
+	for i := 0; i <= last; i++ {
+		var v uint64
+		for _, ba := range bas {
+			if ba != nil && i < len(ba.data) {
+				v |= ba.word(i)
+			}
+		}
+		res.data[i] = v
+	}
+	if last > 0 {
+		res.right = int64(last)
+	}
+	return res
+}
+
+// Intersect returns intersection of BitArrays built in a single pass over
+// words, its length is the shortest one and its mode the one of the first
+// array. A word stops being combined as soon as it is zero. Nil arrays are
+// skipped.
+func Intersect(bas ...*BitArray) *BitArray {
+	var arrays []*BitArray
+	length, last := maxInt, maxInt
+	for _, ba := range bas {
+		if ba == nil {
+			continue
+		}
+		arrays = append(arrays, ba)
+		if n := ba.Len(); n < length {
+			length = n
+		}
+		if l := ba.lastWord(); l < last {
+			last = l
+		}
+	}
+	if len(arrays) == 0 {
+		return New(0, false)
+	}
+	res := New(length, arrays[0].concurrent)
+	if last >= len(res.data) {
+		last = len(res.data) - 1
+	}
+	for i := 0; i <= last; i++ {
+		v := arrays[0].word(i)
+		for _, ba := range arrays[1:] {
+			if v == 0 {
+				break
+			}
+			v &= ba.word(i)
+		}
+		res.data[i] = v
+	}
+	if n := len(res.data); n > 0 {
+		res.data[n-1] &= tailMask(length)
+		res.right = int64(res.lastIndex() >> 6)
+		if res.right < 0 {
+			res.right = 0
+		}
+	}
+	return res
+}
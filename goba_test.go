@@ -2,7 +2,14 @@
 // Distributed under the MIT/X11 software license
 package goba
 
-import "testing"
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
 
 func TestBitArraySetGetRemove(t *testing.T) {
 	ba := New(128, false)
@@ -47,6 +54,274 @@ func TestBitArraySetGetRemove(t *testing.T) {
 	}
 }
 
+func TestNewFromIndices(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := NewFromIndices([]int{70, 3, -5, 200, 3}, concurrent)
+		if ba.Len() != 201 || ba.Count() != 3 || !ba.Get(3) || !ba.Get(70) || !ba.Get(200) {
+			t.Fatalf("failed on test case 1")
+		}
+		if max, _ := ba.MaxSet(); max != 200 {
+			t.Fatalf("failed on test case 2")
+		}
+		if ba = NewFromIndices(nil, concurrent); ba.Len() != 0 || ba.Count() != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+		if ba = NewFromIndices([]int{math.MaxInt, math.MaxInt - 63, 9}, concurrent); ba.Len() != 10 || ba.Count() != 1 {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestNewFromBools(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		vals := make([]bool, 130)
+		vals[0], vals[64], vals[129] = true, true, true
+		ba := NewFromBools(vals, concurrent)
+		if ba.Len() != 130 || ba.Count() != 3 || !ba.Get(0) || !ba.Get(64) || !ba.Get(129) {
+			t.Fatalf("failed on test case 1")
+		}
+		if max, _ := ba.MaxSet(); max != 129 {
+			t.Fatalf("failed on test case 2")
+		}
+		if ba = NewFromBools(nil, concurrent); ba.Len() != 0 || ba.Count() != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+}
+
+func TestBitArrayToBools(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		vals := make([]bool, 130)
+		vals[1], vals[63], vals[128] = true, true, true
+		got := NewFromBools(vals, concurrent).ToBools()
+		if len(got) != len(vals) {
+			t.Fatalf("failed on test case 1")
+		}
+		for i := range vals {
+			if got[i] != vals[i] {
+				t.Fatalf("failed on test case 2")
+			}
+		}
+		if got = New(2, concurrent).AppendBools([]bool{true}); len(got) != 3 || !got[0] || got[1] || got[2] {
+			t.Fatalf("failed on test case 3")
+		}
+		if len(New(0, concurrent).ToBools()) != 0 {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestBitArrayGetOK(t *testing.T) {
+	ba := New(65, false)
+	ba.Set(64)
+
+	if v, ok := ba.GetOK(64); !v || !ok {
+		t.Fatalf("failed on test case 1")
+	}
+	if v, ok := ba.GetOK(0); v || !ok {
+		t.Fatalf("failed on test case 2")
+	}
+	if v, ok := ba.GetOK(65); v || ok {
+		t.Fatalf("failed on test case 3")
+	}
+	if v, ok := ba.GetOK(-1); v || ok {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestBitArrayGetMany(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(130, concurrent)
+		ba.Set(0)
+		ba.Set(3)
+		ba.Set(129)
+
+		dst := []bool{true}
+		got := ba.GetMany([]int{3, 0, 1, 129, 130, -1, 64, 3}, dst)
+		want := []bool{true, true, true, false, true, false, false, false, true}
+		if len(got) != len(want) {
+			t.Fatalf("failed on test case 1")
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("failed on test case 2")
+			}
+		}
+	}
+	var ba *BitArray
+	if got := ba.GetMany([]int{0}, nil); len(got) != 1 || got[0] {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBitArraySetChanged(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(100, concurrent)
+
+		if !ba.SetChanged(70) {
+			t.Fatalf("failed on test case 1")
+		}
+		if ba.SetChanged(70) {
+			t.Fatalf("failed on test case 2")
+		}
+		if !ba.Get(70) || ba.Count() != 1 {
+			t.Fatalf("failed on test case 3")
+		}
+		if ba.SetChanged(100) || ba.SetChanged(-1) {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestBitArraySetChangedConcurrent(t *testing.T) {
+	ba := New(64, true)
+	won := make(chan int, 64*8)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 64; i++ {
+				if ba.SetChanged(i) {
+					won <- i
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(won)
+
+	if len(won) != 64 || ba.Count() != 64 {
+		t.Fatalf("failed on test case 1")
+	}
+}
+
+func TestBitArrayTestAndSet(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(100, concurrent)
+		if ba.TestAndSet(7) || !ba.TestAndSet(7) || !ba.Get(7) {
+			t.Fatalf("failed on test case 1")
+		}
+		if ba.TestAndSet(100) || ba.TestAndSet(-1) || ba.Count() != 1 {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+
+	ba := New(64, true)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var winners int
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !ba.TestAndSet(42) {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if winners != 1 {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBitArrayTestAndClear(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(100, concurrent)
+		ba.Set(7)
+		if !ba.TestAndClear(7) || ba.TestAndClear(7) || ba.Get(7) || ba.TestAndClear(100) {
+			t.Fatalf("failed on test case 1")
+		}
+	}
+
+	// every marked item is consumed once
+	ba := New(1<<12, true)
+	ba.SetAll()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var consumed int
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var n int
+			for i := 0; i < ba.Len(); i++ {
+				if ba.TestAndClear(i) {
+					n++
+				}
+			}
+			mu.Lock()
+			consumed += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if consumed != 1<<12 || ba.Count() != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+}
+
+func TestBitArrayCompareAndSwapBit(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(100, concurrent)
+		if ba.CompareAndSwapBit(5, true, false) || !ba.CompareAndSwapBit(5, false, true) || !ba.Get(5) {
+			t.Fatalf("failed on test case 1")
+		}
+		if !ba.CompareAndSwapBit(5, true, true) || !ba.CompareAndSwapBit(6, false, false) || ba.Count() != 1 {
+			t.Fatalf("failed on test case 2")
+		}
+		if !ba.CompareAndSwapBit(5, true, false) || ba.Get(5) || ba.CompareAndSwapBit(100, false, true) {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+
+	// a spin lock on bit 0 guarding a counter next to busy bits
+	ba := New(64, true)
+	var wg sync.WaitGroup
+	var counter int
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < 1000; n++ {
+				for !ba.CompareAndSwapBit(0, false, true) {
+				}
+				counter++
+				ba.CompareAndSwapBit(0, true, false)
+				ba.CompareAndSwapBit(1+w, false, n%2 == 0)
+				ba.CompareAndSwapBit(1+w, true, n%2 == 0)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if counter != 8000 || ba.Get(0) {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestBitArrayRemoveChanged(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(100, concurrent)
+		ba.Set(99)
+
+		if ba.RemoveChanged(98) {
+			t.Fatalf("failed on test case 1")
+		}
+		if !ba.RemoveChanged(99) {
+			t.Fatalf("failed on test case 2")
+		}
+		if ba.RemoveChanged(99) || ba.Get(99) {
+			t.Fatalf("failed on test case 3")
+		}
+		if ba.RemoveChanged(100) || ba.RemoveChanged(-1) {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
 func TestBitArraySetAllRemoveAll(t *testing.T) {
 	ba := New(67, false)
 
@@ -98,6 +373,48 @@ func TestBitArraySetGetConcurrent(t *testing.T) {
 	}
 }
 
+func TestBitArraySetRemoveSameWordConcurrent(t *testing.T) {
+	// writers of different bits of the same words lose no updates
+	ba := New(256, true)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < 200; n++ {
+				for i := w; i < ba.Len(); i += 8 {
+					ba.Set(i)
+				}
+				for i := w; i < ba.Len(); i += 16 {
+					ba.Remove(i)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if ba.Count() != 128 {
+		t.Fatalf("failed on test case 1")
+	}
+	for i := 0; i < ba.Len(); i++ {
+		if ba.Get(i) != (i%16 >= 8) {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+}
+
+func TestBitArraySetAllWholeWords(t *testing.T) {
+	// the last word of lengths that are a multiple of 64 is full
+	for _, concurrent := range []bool{false, true} {
+		for _, length := range []int{64, 128, 640} {
+			ba := New(length, concurrent)
+			ba.SetAll()
+			if ba.Count() != length || !ba.Get(length-1) || !ba.Get(length-64) {
+				t.Fatalf("failed on test case %d", length)
+			}
+		}
+	}
+}
+
 func TestBitArraySetAllRemoveAllConcurent(t *testing.T) {
 	ba := New(67, true)
 
@@ -190,6 +507,58 @@ func BenchmarkCountSetAllConcurrent(b *testing.B) {
 	}
 }
 
+func TestBitArrayFlipRange(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(300, concurrent)
+		ba.Set(10)
+		ba.Set(200)
+		ba.FlipRange(5, 260)
+		if ba.Count() != 255-2 || ba.Get(4) || !ba.Get(5) || ba.Get(10) || ba.Get(200) || !ba.Get(259) || ba.Get(260) {
+			t.Fatalf("failed on test case 1")
+		}
+		ba.FlipRange(5, 260)
+		if ba.Count() != 2 || !ba.Get(10) || !ba.Get(200) {
+			t.Fatalf("failed on test case 2")
+		}
+		ba.FlipRange(-10, 1000)
+		if ba.Count() != 298 || ba.Get(200) || !ba.Get(299) {
+			t.Fatalf("failed on test case 3")
+		}
+		ba.FlipRange(64, 64)
+		ba.FlipRange(70, 65)
+		if ba.Count() != 298 {
+			t.Fatalf("failed on test case 4")
+		}
+		ba.FlipRange(64, 128)
+		if ba.Count() != 234 || ba.Get(64) || ba.Get(127) || !ba.Get(128) {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+}
+
+func TestBitArraySetRemoveRange(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		ba.SetRange(3, 900)
+		if ba.Count() != 897 || ba.Get(2) || !ba.Get(3) || !ba.Get(899) || ba.Get(900) {
+			t.Fatalf("failed on test case 1")
+		}
+		ba.RemoveRange(64, 640)
+		if ba.Count() != 897-576 || !ba.Get(63) || ba.Get(64) || ba.Get(639) || !ba.Get(640) {
+			t.Fatalf("failed on test case 2")
+		}
+		ba.SetRange(990, 2000)
+		ba.RemoveRange(-5, 4)
+		if ba.Count() != 897-576-1+10 || ba.Get(3) || !ba.Get(999) {
+			t.Fatalf("failed on test case 3")
+		}
+		ba.RemoveRange(0, ba.Len())
+		if ba.Count() != 0 {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
 func TestBitArrayUnify(t *testing.T) {
 	ba1 := New(64, true)
 	ba2 := New(128, true)
@@ -233,3 +602,638 @@ func TestBitArrayIntersect(t *testing.T) {
 	}
 
 }
+
+func TestBitArrayDifference(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		all := New(200, concurrent)
+		all.SetAll()
+		done := New(100, !concurrent)
+		done.Set(0)
+		done.Set(63)
+		done.Set(99)
+
+		pending := all.DifferenceWith(done)
+		if pending.Len() != 200 || pending.Count() != 197 || pending.Get(63) || !pending.Get(199) {
+			t.Fatalf("failed on test case 1")
+		}
+		if all.Count() != 200 || done.DifferenceWith(all).Count() != 0 {
+			t.Fatalf("failed on test case 2")
+		}
+		if got := done.DifferenceWith(New(0, false)); got.Count() != 3 || got.Len() != 100 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+}
+
+func TestBitArrayNot(t *testing.T) {
+	for _, length := range []int{0, 1, 64, 100} {
+		ba := New(length, length%2 == 0)
+		for i := 0; i < length; i += 3 {
+			ba.Set(i)
+		}
+		not := ba.Not()
+		if not.Len() != length || not.Count() != length-ba.Count() {
+			t.Fatalf("failed on test case 1")
+		}
+		for i := 0; i < length; i++ {
+			if not.Get(i) == ba.Get(i) {
+				t.Fatalf("failed on test case 2")
+			}
+		}
+		if not.Not().DiffCount(ba) != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+}
+
+func TestBitArrayIntersectInPlace(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba1 := New(200, concurrent)
+		ba2 := New(100, false)
+		for i := 0; i < 200; i += 2 {
+			ba1.Set(i)
+		}
+		for i := 0; i < 100; i += 3 {
+			ba2.Set(i)
+		}
+		want := ba1.IntersectWith(ba2)
+		ba1.IntersectInPlace(ba2)
+		if ba1.Len() != 200 || ba1.Count() != 17 || want.Count() != 17 || ba1.Get(198) {
+			t.Fatalf("failed on test case 1")
+		}
+		ba1.IntersectInPlace(New(0, false))
+		if ba1.Count() != 0 {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+}
+
+func TestUnion(t *testing.T) {
+	a := New(64, true)
+	b := New(300, false)
+	c := New(100, false)
+	a.Set(0)
+	a.Set(63)
+	b.Set(63)
+	b.Set(299)
+	c.Set(99)
+	u := Union(a, nil, b, c)
+	if u.Len() != 300 || u.Count() != 4 || !u.Get(299) || !u.Get(99) || !u.concurrent {
+		t.Fatalf("failed on test case 1")
+	}
+	if u.DiffCount(a.UnifyWith(b).UnifyWith(c)) != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+	if e := Union(); e.Len() != 0 || e.Count() != 0 {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	a := New(300, true)
+	b := New(200, false)
+	c := New(130, false)
+	for _, i := range []int{0, 63, 64, 129, 199, 299} {
+		a.Set(i)
+		b.Set(i)
+		c.Set(i)
+	}
+	b.Remove(64)
+	x := Intersect(a, nil, b, c)
+	if x.Len() != 130 || x.Count() != 3 || !x.Get(129) || x.Get(64) || !x.concurrent {
+		t.Fatalf("failed on test case 1")
+	}
+	if x.DiffCount(a.IntersectWith(b).IntersectWith(c)) != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+	if y := Intersect(a); y.DiffCount(a) != 0 || y.Len() != 300 {
+		t.Fatalf("failed on test case 3")
+	}
+	if e := Intersect(nil); e.Len() != 0 {
+		t.Fatalf("failed on test case 4")
+	}
+	if e := Intersect(a, New(0, false)); e.Len() != 0 || e.Count() != 0 {
+		t.Fatalf("failed on test case 5")
+	}
+}
+
+func TestBitArrayCloneDiffCount(t *testing.T) {
+	ba := New(200, true)
+	ba.Set(1)
+	ba.Set(150)
+
+	snap := ba.Clone()
+	if snap.Count() != 2 || !snap.Get(150) || snap.Len() != 200 {
+		t.Fatalf("failed on test case 1")
+	}
+	if ba.DiffCount(snap) != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+
+	ba.Remove(1)
+	ba.Set(2)
+	ba.Set(199)
+	if ba.DiffCount(snap) != 3 || snap.DiffCount(ba) != 3 {
+		t.Fatalf("failed on test case 3")
+	}
+
+	short := New(64, false)
+	short.Set(2)
+	if ba.DiffCount(short) != 2 {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestBitArrayCountAnd(t *testing.T) {
+	a := New(300, true)
+	b := New(100, false)
+	for i := 0; i < 300; i += 2 {
+		a.Set(i)
+	}
+	for i := 0; i < 100; i += 3 {
+		b.Set(i)
+	}
+	if a.CountAnd(b) != 17 || b.CountAnd(a) != 17 || a.CountAnd(b) != a.IntersectWith(b).Count() {
+		t.Fatalf("failed on test case 1")
+	}
+	if a.CountAnd(New(0, false)) != 0 || a.CountAnd(a) != 150 {
+		t.Fatalf("failed on test case 2")
+	}
+}
+
+func TestBitArrayCountOr(t *testing.T) {
+	a := New(300, false)
+	b := New(100, true)
+	for i := 0; i < 300; i += 2 {
+		a.Set(i)
+	}
+	for i := 0; i < 100; i += 3 {
+		b.Set(i)
+	}
+	if a.CountOr(b) != 150+34-17 || b.CountOr(a) != a.CountOr(b) || a.CountOr(b) != a.UnifyWith(b).Count() {
+		t.Fatalf("failed on test case 1")
+	}
+	if a.CountOr(New(0, false)) != 150 {
+		t.Fatalf("failed on test case 2")
+	}
+}
+
+func TestBitArrayHammingDistance(t *testing.T) {
+	a := New(128, false)
+	b := New(64, true)
+	a.Set(0)
+	a.Set(5)
+	a.Set(100)
+	b.Set(5)
+	b.Set(6)
+	if a.HammingDistance(b) != 3 || b.HammingDistance(a) != 3 || a.HammingDistance(a) != 0 {
+		t.Fatalf("failed on test case 1")
+	}
+}
+
+func TestBitArraySubset(t *testing.T) {
+	perms := New(200, true)
+	need := New(64, false)
+	for _, i := range []int{1, 5, 63, 150} {
+		perms.Set(i)
+	}
+	need.Set(5)
+	need.Set(63)
+	if !need.IsSubsetOf(perms) || !perms.IsSupersetOf(need) || perms.IsSubsetOf(need) {
+		t.Fatalf("failed on test case 1")
+	}
+	need.Set(6)
+	if need.IsSubsetOf(perms) || perms.IsSupersetOf(need) {
+		t.Fatalf("failed on test case 2")
+	}
+	if !New(10, false).IsSubsetOf(New(0, false)) || !perms.IsSubsetOf(perms) {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBitArrayEqual(t *testing.T) {
+	a := New(100, true)
+	b := New(100, false)
+	a.Set(7)
+	if a.Equal(b) || !a.Equal(a) {
+		t.Fatalf("failed on test case 1")
+	}
+	b.Set(7)
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Fatalf("failed on test case 2")
+	}
+	if a.Equal(New(101, false)) || New(0, false).Equal(nil) || !New(0, false).Equal(New(0, true)) {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBitArrayCompare(t *testing.T) {
+	mk := func(bits string) *BitArray {
+		ba := New(len(bits), len(bits)%2 == 0)
+		for i, c := range bits {
+			if c == '1' {
+				ba.Set(i)
+			}
+		}
+		return ba
+	}
+	// in ascending order
+	sorted := []string{"", "0", "00", strings.Repeat("0", 70), "0001", "001", "01", "1", "10",
+		"1000000000", "11", strings.Repeat("1", 63) + "01", strings.Repeat("1", 65)}
+	for i, a := range sorted {
+		for j, b := range sorted {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := mk(a).Compare(mk(b)); got != want {
+				t.Fatalf("failed on test case 1: %q %q", a, b)
+			}
+		}
+	}
+}
+
+func TestBitArrayCopyFrom(t *testing.T) {
+	dst := New(1000, false)
+	dst.SetAll()
+	data := &dst.data[0]
+	src := New(100, true)
+	src.Set(3)
+	src.Set(99)
+	if err := dst.CopyFrom(src); err != nil || !dst.Equal(src) || &dst.data[0] != data {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	// reused words past the copy are cleared
+	if err := dst.CopyFrom(New(900, false)); err != nil || dst.Len() != 900 || dst.Count() != 0 || &dst.data[0] != data {
+		t.Fatalf("failed on test case 2: %v", err)
+	}
+	big := New(5000, false)
+	big.Set(4999)
+	if err := dst.CopyFrom(big); err != nil || !dst.Equal(big) {
+		t.Fatalf("failed on test case 3: %v", err)
+	}
+
+	c := New(100, true)
+	c.Set(50)
+	if err := c.CopyFrom(src); err != nil || !c.Equal(src) {
+		t.Fatalf("failed on test case 4: %v", err)
+	}
+	if err := c.CopyFrom(big); !errors.Is(err, ErrLengthMismatch) || !c.Equal(src) {
+		t.Fatalf("failed on test case 5: %v", err)
+	}
+}
+
+func TestBitArrayMergeFrom(t *testing.T) {
+	a := New(64, false)
+	b := New(130, false)
+	c := New(100, true)
+
+	a.Set(1)
+	b.Set(2)
+	b.Set(129)
+	c.Set(99)
+
+	a.MergeFrom(b)
+	if a.Len() != 130 || a.Count() != 3 || !a.Get(129) {
+		t.Fatalf("failed on test case 1")
+	}
+
+	// idempotent and order independent
+	a.MergeFrom(b)
+	a.MergeFrom(c)
+	c.MergeFrom(b)
+	c.MergeFrom(a)
+	if a.Count() != 4 || a.DiffCount(c) != 0 || c.Len() != 130 {
+		t.Fatalf("failed on test case 2")
+	}
+
+	a.MergeFrom(New(10, false))
+	if a.Len() != 130 || a.Count() != 4 {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestFirstIntersecting(t *testing.T) {
+	q := New(1000, true)
+	a, b, c := New(1000, false), New(100, true), New(2000, false)
+	a.Set(1)
+	b.Set(70)
+	c.Set(900)
+	if i, ok := FirstIntersecting(q, []*BitArray{a, b, c}); ok || i != -1 {
+		t.Fatalf("failed on test case 1")
+	}
+	q.Set(70)
+	q.Set(900)
+	if i, ok := FirstIntersecting(q, []*BitArray{a, nil, b, c}); !ok || i != 2 {
+		t.Fatalf("failed on test case 2")
+	}
+	if i, ok := FirstIntersecting(q, []*BitArray{a, c}); !ok || i != 1 {
+		t.Fatalf("failed on test case 3")
+	}
+	if _, ok := FirstIntersecting(q, nil); ok {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestIntersectWithSkewed(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		dense, sparse := New(1<<16, concurrent), New(1<<16, concurrent)
+		for i := 0; i < 1<<16; i += 2 {
+			dense.Set(i)
+		}
+		for _, i := range []int{0, 1, 4000, 4001, 65534} {
+			sparse.Set(i)
+		}
+		for n, res := range []*BitArray{sparse.IntersectWith(dense), dense.IntersectWith(sparse)} {
+			if res.Count() != 3 || !res.Get(0) || !res.Get(4000) || !res.Get(65534) || res.Get(1) {
+				t.Fatalf("failed on test case %d", n+1)
+			}
+		}
+	}
+}
+
+func BenchmarkIntersectWithSkewed(b *testing.B) {
+	dense, sparse := New(1<<24, false), New(1<<24, false)
+	dense.SetAll()
+	for i := 0; i < 1<<24; i += 1 << 14 {
+		sparse.Set(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dense.IntersectWith(sparse)
+	}
+}
+
+func TestBitArrayCountRange(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		ba.SetRange(100, 700)
+		if ba.CountRange(0, 1000) != 600 || ba.CountRange(150, 160) != 10 || ba.CountRange(64, 128) != 28 {
+			t.Fatalf("failed on test case 1")
+		}
+		if ba.CountRange(699, 701) != 1 || ba.CountRange(-50, 101) != 1 || ba.CountRange(600, 5000) != 100 {
+			t.Fatalf("failed on test case 2")
+		}
+		if ba.CountRange(500, 500) != 0 || ba.CountRange(600, 500) != 0 || ba.CountRange(800, 1000) != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+}
+
+func TestBitArrayRangePredicates(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		ba.SetRange(100, 700)
+		if !ba.AllInRange(100, 700) || ba.AllInRange(99, 700) || ba.AllInRange(100, 701) || ba.AllInRange(650, 5000) {
+			t.Fatalf("failed on test case 1")
+		}
+		if !ba.AnyInRange(0, 101) || ba.AnyInRange(0, 100) || ba.AnyInRange(700, 1000) || !ba.AnyInRange(699, 5000) {
+			t.Fatalf("failed on test case 2")
+		}
+		if !ba.NoneInRange(0, 100) || ba.NoneInRange(0, 1000) || !ba.NoneInRange(800, 900) {
+			t.Fatalf("failed on test case 3")
+		}
+		if !ba.AllInRange(5, 5) || ba.AnyInRange(5, 5) || !ba.NoneInRange(300, 200) {
+			t.Fatalf("failed on test case 4")
+		}
+		ba.SetAll()
+		if !ba.AllInRange(-5, 5000) {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+}
+
+func TestBitArrayNextSet(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		for _, i := range []int{0, 63, 64, 500, 999} {
+			ba.Set(i)
+		}
+		var got []int
+		for i, ok := ba.NextSet(0); ok; i, ok = ba.NextSet(i + 1) {
+			got = append(got, i)
+		}
+		if len(got) != 5 || got[1] != 63 || got[2] != 64 || got[4] != 999 {
+			t.Fatalf("failed on test case 1")
+		}
+		if i, ok := ba.NextSet(-7); !ok || i != 0 {
+			t.Fatalf("failed on test case 2")
+		}
+		if i, ok := ba.NextSet(1000); ok || i != -1 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+}
+
+func TestBitArrayNextClear(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(200, concurrent)
+		ba.SetAll()
+		ba.Remove(70)
+		ba.Remove(199)
+		if i, ok := ba.NextClear(0); !ok || i != 70 {
+			t.Fatalf("failed on test case 1")
+		}
+		if i, ok := ba.NextClear(71); !ok || i != 199 {
+			t.Fatalf("failed on test case 2")
+		}
+		ba.Set(199)
+		if i, ok := ba.NextClear(71); ok || i != -1 {
+			t.Fatalf("failed on test case 3")
+		}
+		if i, ok := New(10, concurrent).NextClear(-3); !ok || i != 0 {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestBitArrayPrevSet(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		for _, i := range []int{0, 63, 64, 500, 998} {
+			ba.Set(i)
+		}
+		var got []int
+		for i, ok := ba.PrevSet(5000); ok; i, ok = ba.PrevSet(i - 1) {
+			got = append(got, i)
+		}
+		if len(got) != 5 || got[0] != 998 || got[2] != 64 || got[3] != 63 || got[4] != 0 {
+			t.Fatalf("failed on test case 1")
+		}
+		if i, ok := ba.PrevSet(499); !ok || i != 64 {
+			t.Fatalf("failed on test case 2")
+		}
+		if i, ok := ba.PrevSet(-1); ok || i != -1 {
+			t.Fatalf("failed on test case 3")
+		}
+		ba.Remove(0)
+		if _, ok := ba.PrevSet(62); ok {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestBitArrayMinMaxSet(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		if _, ok := ba.MinSet(); ok {
+			t.Fatalf("failed on test case 1")
+		}
+		if _, ok := ba.MaxSet(); ok {
+			t.Fatalf("failed on test case 1")
+		}
+		ba.Set(700)
+		ba.Set(70)
+		ba.Set(900)
+		ba.Remove(900)
+		if i, ok := ba.MinSet(); !ok || i != 70 {
+			t.Fatalf("failed on test case 2")
+		}
+		if i, ok := ba.MaxSet(); !ok || i != 700 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+	if _, ok := New(0, false).MaxSet(); ok {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestBitArrayIndices(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		want := []int{0, 1, 63, 64, 500, 999}
+		for _, i := range want {
+			ba.Set(i)
+		}
+		got := ba.Indices()
+		if len(got) != len(want) || cap(got) != len(want) {
+			t.Fatalf("failed on test case 1")
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("failed on test case 2")
+			}
+		}
+		buf := make([]int, 1, 16)
+		if got = ba.AppendIndices(buf); len(got) != 7 || got[0] != 0 || got[6] != 999 || &got[0] != &buf[0] {
+			t.Fatalf("failed on test case 3")
+		}
+		if len(New(10, concurrent).Indices()) != 0 {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestCountFromUpTo(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(300, concurrent)
+		for _, i := range []int{0, 63, 64, 200, 299} {
+			s.Set(i)
+		}
+		if s.CountFrom(0) != 5 || s.CountFrom(64) != 3 || s.CountFrom(65) != 2 || s.CountFrom(300) != 0 || s.CountFrom(-5) != 5 {
+			t.Fatalf("failed on test case 1")
+		}
+		if s.CountUpTo(0) != 0 || s.CountUpTo(64) != 2 || s.CountUpTo(299) != 4 || s.CountUpTo(1000) != 5 {
+			t.Fatalf("failed on test case 2")
+		}
+		for i := 0; i <= 300; i++ {
+			if s.CountUpTo(i)+s.CountFrom(i) != 5 {
+				t.Fatalf("failed on test case 3")
+			}
+		}
+	}
+}
+
+func TestNewInBuffer(t *testing.T) {
+	buf := []uint64{1, 0, ^uint64(0), 7}
+	s := NewInBuffer(buf, 130, false)
+	if s.Len() != 130 || s.Count() != 3 || buf[2] != 3 || buf[3] != 7 {
+		t.Fatalf("failed on test case 1")
+	}
+	s.Set(64)
+	if buf[1] != 1 || s.nextSet(1) != 64 {
+		t.Fatalf("failed on test case 2")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("failed on test case 3")
+		}
+	}()
+	NewInBuffer(buf, 257, true)
+}
+
+func TestEstimateCount(t *testing.T) {
+	s := New(1<<20, true)
+	for i := 0; i < 1<<20; i += 4 {
+		s.Set(i)
+	}
+	for i := 0; i < 1<<18; i++ {
+		s.Set(i)
+	}
+	est, bound := s.EstimateCount(4096)
+	if bound <= 0 || math.Abs(float64(est-s.Count())) > 2*bound {
+		t.Fatalf("failed on test case 1")
+	}
+	est, bound = New(1000, false).EstimateCount(4)
+	if est != 0 || bound != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+	if est, bound = s.EstimateCount(1 << 20); est != s.Count() || bound != 0 {
+		t.Fatalf("failed on test case 3")
+	}
+	// all but one word sampled without replacement is nearly exact
+	words := (1 << 20) / 64
+	if est, bound = s.EstimateCount(words - 1); math.Abs(float64(est-s.Count())) > 64 || bound > 64 {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestReservoirSample(t *testing.T) {
+	s := New(1000, false)
+	for i := 0; i < 1000; i += 10 {
+		s.Set(i)
+	}
+	rng := rand.New(rand.NewSource(1))
+	if s.ReservoirSample(rng, 0) != nil || len(s.ReservoirSample(nil, 500)) != 100 {
+		t.Fatalf("failed on test case 1")
+	}
+	// every set bit is picked about equally often
+	hits := make(map[int]int)
+	for n := 0; n < 2000; n++ {
+		got := s.ReservoirSample(rng, 10)
+		seen := New(1000, false)
+		for _, i := range got {
+			if !s.Get(i) || !seen.SetChanged(i) {
+				t.Fatalf("failed on test case 2")
+			}
+			hits[i]++
+		}
+		if len(got) != 10 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+	// 200 hits expected per bit, binomial sd is about 13.4
+	for i := 0; i < 1000; i += 10 {
+		if hits[i] < 130 || hits[i] > 270 {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+	// k above the count returns every set bit in random order
+	all := s.ReservoirSample(rng, math.MaxInt)
+	ascending := true
+	for i := 1; i < len(all); i++ {
+		ascending = ascending && all[i-1] < all[i]
+	}
+	if len(all) != 100 || ascending || New(10, false).ReservoirSample(nil, math.MaxInt) != nil {
+		t.Fatalf("failed on test case 6")
+	}
+	a := s.ReservoirSample(rand.New(rand.NewSource(7)), 5)
+	b := s.ReservoirSample(rand.New(rand.NewSource(7)), 5)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+}
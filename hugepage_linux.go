@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+
+//go:build linux && !purego
+
+package goba
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Size of a transparent huge page on the common Linux targets,
+// smaller arrays gain nothing from being backed by huge pages.
+const hugePageSize = 2 << 20
+
+// NewHugePages returns an instantiated BitArray struct with data words
+// backed by anonymous mmap'd memory advised with MADV_HUGEPAGE, which
+// reduces TLB misses of random access to multi-GB arrays.
+//
+// Arrays smaller than a huge page are allocated with New. RemoveAll hands
+// the pages back to the kernel with MADV_DONTNEED instead of zeroing them.
+// The memory is not managed by the garbage collector and must be released
+// with Free.
+func NewHugePages(length int, concurrent bool) (*BitArray, error) {
+	words := (length + 63) / 64
+	if words*8 < hugePageSize {
+		return New(length, concurrent), nil
+	}
+	res, err := newMapped(length, concurrent)
+	if err != nil {
+		return nil, err
+	}
+	// transparent huge pages may be disabled, the mapping is usable anyway
+	_ = syscall.Madvise(res.mapped, syscall.MADV_HUGEPAGE)
+	return res, nil
+}
+
+// NewOffHeap returns an instantiated BitArray struct with data words
+// backed by anonymous mmap'd memory outside of the Go heap, so large
+// arrays neither add to garbage collection scans nor to the heap goal.
+//
+// RemoveAll hands the pages back to the kernel with MADV_DONTNEED.
+// The memory must be released with Free.
+func NewOffHeap(length int, concurrent bool) (*BitArray, error) {
+	if length <= 0 {
+		return New(length, concurrent), nil
+	}
+	return newMapped(length, concurrent)
+}
+
+func newMapped(length int, concurrent bool) (*BitArray, error) {
+	words := (length + 63) / 64
+	mem, err := syscall.Mmap(-1, 0, words*8,
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	res := BitArray{
+		length:     int64(length),
+		concurrent: concurrent,
+		mapped:     mem,
+	}
+	res.data = unsafe.Slice((*uint64)(unsafe.Pointer(&mem[0])), words)
+	return &res, nil
+}
+
+func unmap(mem []byte) error {
+	return syscall.Munmap(mem)
+}
+
+// releasePages zeroes mapped memory by dropping its pages,
+// private anonymous pages read back as zeros afterwards.
+func releasePages(mem []byte) error {
+	return syscall.Madvise(mem, syscall.MADV_DONTNEED)
+}
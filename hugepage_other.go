@@ -0,0 +1,34 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+
+//go:build !linux || purego
+
+package goba
+
+import "errors"
+
+var errNotMapped = errors.New("goba: mmap is not supported in this build")
+
+// NewHugePages returns an instantiated BitArray struct.
+//
+// Huge pages are only supported on Linux without the purego build tag,
+// elsewhere it is equivalent to New.
+func NewHugePages(length int, concurrent bool) (*BitArray, error) {
+	return New(length, concurrent), nil
+}
+
+// NewOffHeap returns an instantiated BitArray struct.
+//
+// Off-heap memory is only supported on Linux without the purego build tag,
+// elsewhere it is equivalent to New.
+func NewOffHeap(length int, concurrent bool) (*BitArray, error) {
+	return New(length, concurrent), nil
+}
+
+func unmap(mem []byte) error {
+	return errNotMapped
+}
+
+func releasePages(mem []byte) error {
+	return errNotMapped
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestBitArrayHugePages(t *testing.T) {
+	ba, err := NewHugePages(1<<24, false)
+	if err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+
+	ba.Set(0)
+	ba.Set(1 << 20)
+	ba.Set(1<<24 - 1)
+
+	if !ba.Get(1<<20) || ba.Get(1<<20+1) {
+		t.Fatalf("failed on test case 2")
+	}
+	if ba.Count() != 3 {
+		t.Fatalf("failed on test case 3")
+	}
+
+	ba.RemoveAll()
+	if ba.Count() != 0 || ba.Get(0) {
+		t.Fatalf("failed on test case 4")
+	}
+
+	ba.Set(5)
+	if !ba.Get(5) {
+		t.Fatalf("failed on test case 5")
+	}
+
+	if err := ba.Free(); err != nil {
+		t.Fatalf("failed on test case 6: %v", err)
+	}
+	if ba.Len() != 0 || ba.Get(5) {
+		t.Fatalf("failed on test case 7")
+	}
+}
+
+func TestBitArrayHugePagesSmall(t *testing.T) {
+	ba, err := NewHugePages(100, true)
+	if err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	ba.SetAll()
+	if ba.Count() != 100 {
+		t.Fatalf("failed on test case 2")
+	}
+	if err := ba.Free(); err != nil {
+		t.Fatalf("failed on test case 3: %v", err)
+	}
+}
+
+func TestBitArrayOffHeap(t *testing.T) {
+	for _, length := range []int{0, 100, 1 << 20} {
+		ba, err := NewOffHeap(length, true)
+		if err != nil {
+			t.Fatalf("failed on test case 1: %v", err)
+		}
+		ba.SetAll()
+		if ba.Count() != length {
+			t.Fatalf("failed on test case 2")
+		}
+		ba.RemoveAll()
+		if ba.Count() != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+		if err := ba.Free(); err != nil {
+			t.Fatalf("failed on test case 4: %v", err)
+		}
+	}
+}
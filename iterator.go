@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// iterBlockWords is the size in words of blocks copied by Iterator
+const iterBlockWords = 64
+
+// iterPassed marks blocks Iterator is done with
+var iterPassed = make([]uint64, 0)
+
+// Iterator iterates over set bits of BitArray as of its creation.
+//
+// Blocks of 64 words are copied lazily: on first touch by the iterator or
+// right before a writer changes them, whichever comes first, so writers
+// running during the iteration are not seen and only blocks written ahead
+// of the iterator are copied. Writes racing with the creation of the
+// iterator may or may not be seen.
+type Iterator struct {
+	s      *BitArray
+	length int
+	next   int
+
+	mu     sync.Mutex
+	blocks [][]uint64 // copied blocks, nil until touched
+}
+
+// Iterate returns an Iterator over set bits of BitArray,
+// Close releases it unless Next has reported the end
+func (s *BitArray) Iterate() *Iterator {
+	it := &Iterator{
+		s:      s,
+		length: s.Len(),
+		blocks: make([][]uint64, (len(s.data)+iterBlockWords-1)/iterBlockWords),
+	}
+	for {
+		old := s.iters.Load()
+		var its []*Iterator
+		if old != nil {
+			its = append(its, *old...)
+		}
+		its = append(its, it)
+		if s.iters.CompareAndSwap(old, &its) {
+			return it
+		}
+	}
+}
+
+// Next returns index of the next set bit, ok is false at the end
+func (it *Iterator) Next() (index int, ok bool) {
+	for it.next < it.length {
+		b := it.next / (iterBlockWords * 64)
+		blk := it.block(b)
+		w := it.next>>6 - b*iterBlockWords
+		if v := blk[w] >> (it.next & 0x3f); v != 0 {
+			index = it.next + bits.TrailingZeros64(v)
+			it.next = index + 1
+			if index < it.length {
+				return index, true
+			}
+			break
+		}
+		it.next = (it.next>>6 + 1) << 6
+		if it.next/(iterBlockWords*64) != b {
+			it.release(b)
+		}
+	}
+	it.next = it.length
+	it.Close()
+	return -1, false
+}
+
+// Close releases Iterator, writers stop copying blocks for it
+func (it *Iterator) Close() {
+	s := it.s
+	for {
+		old := s.iters.Load()
+		if old == nil {
+			return
+		}
+		var its []*Iterator
+		for _, o := range *old {
+			if o != it {
+				its = append(its, o)
+			}
+		}
+		if len(its) == len(*old) {
+			return
+		}
+		var p *[]*Iterator
+		if len(its) > 0 {
+			p = &its
+		}
+		if s.iters.CompareAndSwap(old, p) {
+			return
+		}
+	}
+}
+
+// block returns the copy of block b, copying it on first touch
+func (it *Iterator) block(b int) []uint64 {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if it.blocks[b] == nil {
+		it.blocks[b] = it.copyBlock(b)
+	}
+	return it.blocks[b]
+}
+
+// release drops the copy of block b once the iteration is past it
+func (it *Iterator) release(b int) {
+	it.mu.Lock()
+	it.blocks[b] = iterPassed
+	it.mu.Unlock()
+}
+
+// preserve copies blocks of words [lo, hi] not copied yet
+func (it *Iterator) preserve(lo, hi int) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	for b := lo / iterBlockWords; b <= hi/iterBlockWords && b < len(it.blocks); b++ {
+		if it.blocks[b] == nil {
+			it.blocks[b] = it.copyBlock(b)
+		}
+	}
+}
+
+func (it *Iterator) copyBlock(b int) []uint64 {
+	lo := b * iterBlockWords
+	hi := lo + iterBlockWords
+	if words := (it.length + 63) / 64; hi > words {
+		hi = words
+	}
+	res := make([]uint64, hi-lo)
+	for i := range res {
+		res[i] = it.s.word(lo + i)
+	}
+	return res
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(20000, concurrent)
+		want := []int{0, 63, 64, 4095, 4096, 10000, 19999}
+		for _, i := range want {
+			s.Set(i)
+		}
+		it := s.Iterate()
+		var got []int
+		for i, ok := it.Next(); ok; i, ok = it.Next() {
+			got = append(got, i)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("failed on test case 1")
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("failed on test case 1")
+			}
+		}
+		if _, ok := it.Next(); ok || s.iters.Load() != nil {
+			t.Fatalf("failed on test case 2")
+		}
+		// writes after creation are not seen
+		it = s.Iterate()
+		if i, _ := it.Next(); i != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+		s.Remove(4096)
+		s.Set(5000)
+		s.SetAll()
+		var n int
+		for _, ok := it.Next(); ok; _, ok = it.Next() {
+			n++
+		}
+		if n != len(want)-1 {
+			t.Fatalf("failed on test case 4")
+		}
+		it = s.Iterate()
+		it.Close()
+		if s.iters.Load() != nil {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+}
+
+func TestIteratorConcurrentWriters(t *testing.T) {
+	s := New(1<<16, true)
+	for i := 0; i < s.Len(); i += 3 {
+		s.Set(i)
+	}
+	it := s.Iterate()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < s.Len(); i += 4 {
+				if i%3 == 0 {
+					s.Remove(i)
+				} else {
+					s.Set(i)
+				}
+			}
+		}(g)
+	}
+	var n int
+	for i, ok := it.Next(); ok; i, ok = it.Next() {
+		if i%3 != 0 {
+			t.Fatalf("failed on test case 1")
+		}
+		n++
+	}
+	wg.Wait()
+	if n != (s.Len()+2)/3 {
+		t.Fatalf("failed on test case 2")
+	}
+}
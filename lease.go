@@ -0,0 +1,159 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// LeaseMap is a BitArray of slots owned under expiring leases.
+//
+// A claimed slot holds its bit until the lease is released or expires, so
+// slots of crashed owners return to the pool after their lease time. Every
+// claim gets a new fencing token and only its holder can renew or release
+// the lease, a late owner cannot touch a slot claimed by someone else after
+// its own lease expired. Expired leases are cleared on access. It is safe
+// for concurrent usage.
+type LeaseMap struct {
+	mu     sync.Mutex
+	held   *BitArray
+	leases map[int]lease
+	queue  leaseQueue // deadlines, entries of ended leases are skipped
+	token  uint64     // token of the last claim
+}
+
+type lease struct {
+	token    uint64
+	deadline int64 // unix nanoseconds
+}
+
+type leaseEntry struct {
+	index    int
+	token    uint64
+	deadline int64
+}
+
+// NewLeaseMap returns an instantiated LeaseMap of slots [0, length)
+func NewLeaseMap(length int) *LeaseMap {
+	return &LeaseMap{
+		held:   New(length, false),
+		leases: make(map[int]lease),
+	}
+}
+
+// Claim sets bit at index under a lease of ttl if it is not held and
+// returns the token of the lease
+func (m *LeaseMap) Claim(index int, ttl time.Duration) (uint64, bool) {
+	return m.ClaimAt(index, ttl, time.Now())
+}
+
+// ClaimAt is Claim at time t
+func (m *LeaseMap) ClaimAt(index int, ttl time.Duration, t time.Time) (uint64, bool) {
+	if index < 0 || index >= m.held.Len() {
+		return 0, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(t.UnixNano())
+	if !m.held.SetChanged(index) {
+		return 0, false
+	}
+	m.token++
+	m.extend(index, lease{m.token, t.Add(ttl).UnixNano()})
+	return m.token, true
+}
+
+// Renew extends the lease of token on index to ttl from now, it reports
+// false when the lease has ended
+func (m *LeaseMap) Renew(index int, token uint64, ttl time.Duration) bool {
+	return m.RenewAt(index, token, ttl, time.Now())
+}
+
+// RenewAt is Renew at time t
+func (m *LeaseMap) RenewAt(index int, token uint64, ttl time.Duration, t time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(t.UnixNano())
+	if l, ok := m.leases[index]; !ok || l.token != token {
+		return false
+	}
+	m.extend(index, lease{token, t.Add(ttl).UnixNano()})
+	return true
+}
+
+// Release clears bit at index held under the lease of token, it reports
+// false when the lease has ended already
+func (m *LeaseMap) Release(index int, token uint64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.leases[index]; !ok || l.token != token {
+		return false
+	}
+	delete(m.leases, index)
+	m.held.Remove(index)
+	return true
+}
+
+// Held reports whether index is held under a lease now
+func (m *LeaseMap) Held(index int) bool {
+	return m.HeldAt(index, time.Now())
+}
+
+// HeldAt is Held at time t
+func (m *LeaseMap) HeldAt(index int, t time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(t.UnixNano())
+	return m.held.Get(index)
+}
+
+// ExpireAt clears leases ended at time t and returns their indices
+// in order of deadlines
+func (m *LeaseMap) ExpireAt(t time.Time) []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expire(t.UnixNano())
+}
+
+// ActiveAt returns a copy of bits held at time t
+func (m *LeaseMap) ActiveAt(t time.Time) *BitArray {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(t.UnixNano())
+	return m.held.Clone()
+}
+
+func (m *LeaseMap) extend(index int, l lease) {
+	m.leases[index] = l
+	heap.Push(&m.queue, leaseEntry{index, l.token, l.deadline})
+}
+
+// expire clears leases with deadlines at or before now
+func (m *LeaseMap) expire(now int64) []int {
+	var res []int
+	for len(m.queue) > 0 && m.queue[0].deadline <= now {
+		e := heap.Pop(&m.queue).(leaseEntry)
+		if l, ok := m.leases[e.index]; ok && l.token == e.token && l.deadline == e.deadline {
+			delete(m.leases, e.index)
+			m.held.Remove(e.index)
+			res = append(res, e.index)
+		}
+	}
+	return res
+}
+
+// leaseQueue is a min-heap of lease deadlines
+type leaseQueue []leaseEntry
+
+func (q leaseQueue) Len() int           { return len(q) }
+func (q leaseQueue) Less(i, j int) bool { return q[i].deadline < q[j].deadline }
+func (q leaseQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *leaseQueue) Push(x any)        { *q = append(*q, x.(leaseEntry)) }
+func (q *leaseQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseMap(t *testing.T) {
+	m := NewLeaseMap(100)
+	t0 := time.Unix(1000, 0)
+
+	a, ok := m.ClaimAt(5, 10*time.Second, t0)
+	if !ok || !m.HeldAt(5, t0) {
+		t.Fatalf("failed on test case 1")
+	}
+	if _, ok = m.ClaimAt(5, time.Second, t0); ok {
+		t.Fatalf("failed on test case 2")
+	}
+	if _, ok = m.ClaimAt(100, time.Second, t0); ok {
+		t.Fatalf("failed on test case 3")
+	}
+
+	// renewal moves the deadline
+	if !m.RenewAt(5, a, 10*time.Second, t0.Add(8*time.Second)) || m.RenewAt(5, a+1, time.Second, t0) {
+		t.Fatalf("failed on test case 4")
+	}
+	if !m.HeldAt(5, t0.Add(15*time.Second)) || m.HeldAt(5, t0.Add(18*time.Second)) {
+		t.Fatalf("failed on test case 5")
+	}
+
+	// a late owner cannot touch the slot claimed after its lease expired
+	b, ok := m.ClaimAt(5, 10*time.Second, t0.Add(20*time.Second))
+	if !ok || b == a {
+		t.Fatalf("failed on test case 6")
+	}
+	if m.RenewAt(5, a, time.Minute, t0.Add(21*time.Second)) || m.Release(5, a) {
+		t.Fatalf("failed on test case 7")
+	}
+	if !m.Release(5, b) || m.Release(5, b) || m.HeldAt(5, t0.Add(21*time.Second)) {
+		t.Fatalf("failed on test case 8")
+	}
+
+	m.ClaimAt(1, 3*time.Second, t0)
+	m.ClaimAt(2, time.Second, t0)
+	m.ClaimAt(3, time.Hour, t0)
+	if ba := m.ActiveAt(t0); ba.Count() != 3 {
+		t.Fatalf("failed on test case 9")
+	}
+	if got := m.ExpireAt(t0.Add(5 * time.Second)); len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Fatalf("failed on test case 10")
+	}
+	if ba := m.ActiveAt(t0.Add(5 * time.Second)); ba.Count() != 1 || !ba.Get(3) {
+		t.Fatalf("failed on test case 11")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "sync"
+
+// LockedBitArray guards a BitArray with a sync.RWMutex instead of atomics
+// per word.
+//
+// Every operation holds the lock as a whole, so multi-word reads like
+// Count or UnifyWith are linearizable under concurrent writers where the
+// concurrent mode of BitArray may return results mixing states before and
+// after a write. Writers exclude each other and readers. It is safe for
+// concurrent usage.
+type LockedBitArray struct {
+	mu sync.RWMutex
+	ba *BitArray
+}
+
+// NewLocked returns an instantiated LockedBitArray of length bits
+func NewLocked(length int) *LockedBitArray {
+	return &LockedBitArray{ba: New(length, false)}
+}
+
+// Len returns length in bits
+func (l *LockedBitArray) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ba.Len()
+}
+
+// Set sets bit at index
+func (l *LockedBitArray) Set(index int) {
+	l.mu.Lock()
+	l.ba.Set(index)
+	l.mu.Unlock()
+}
+
+// Remove removes bit at index
+func (l *LockedBitArray) Remove(index int) {
+	l.mu.Lock()
+	l.ba.Remove(index)
+	l.mu.Unlock()
+}
+
+// Get returns bit value at index
+func (l *LockedBitArray) Get(index int) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ba.Get(index)
+}
+
+// SetAll sets all bits
+func (l *LockedBitArray) SetAll() {
+	l.mu.Lock()
+	l.ba.SetAll()
+	l.mu.Unlock()
+}
+
+// RemoveAll removes all bits
+func (l *LockedBitArray) RemoveAll() {
+	l.mu.Lock()
+	l.ba.RemoveAll()
+	l.mu.Unlock()
+}
+
+// Count returns count of set bits
+func (l *LockedBitArray) Count() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ba.Count()
+}
+
+// UnifyWith returns union with ba, ba must not change during the call
+func (l *LockedBitArray) UnifyWith(ba *BitArray) *BitArray {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ba.UnifyWith(ba)
+}
+
+// IntersectWith returns intersection with ba, ba must not change during
+// the call
+func (l *LockedBitArray) IntersectWith(ba *BitArray) *BitArray {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ba.IntersectWith(ba)
+}
+
+// Clone returns a copy of BitArray
+func (l *LockedBitArray) Clone() *BitArray {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ba.Clone()
+}
+
+// View calls fn with BitArray under the read lock, fn must not write to
+// it or keep it after returning
+func (l *LockedBitArray) View(fn func(ba *BitArray)) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	fn(l.ba)
+}
+
+// Update calls fn with BitArray under the write lock, readers see either
+// none or all of the writes of fn
+func (l *LockedBitArray) Update(fn func(ba *BitArray)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(l.ba)
+}
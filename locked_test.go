@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLockedBitArray(t *testing.T) {
+	l := NewLocked(200)
+	l.Set(5)
+	l.Set(150)
+	l.Set(200)
+	if l.Len() != 200 || l.Count() != 2 || !l.Get(150) || l.Get(6) {
+		t.Fatalf("failed on test case 1")
+	}
+	l.Remove(5)
+	other := New(200, false)
+	other.Set(7)
+	other.Set(150)
+	if l.UnifyWith(other).Count() != 2 || l.IntersectWith(other).Count() != 1 {
+		t.Fatalf("failed on test case 2")
+	}
+	l.SetAll()
+	if l.Clone().Count() != 200 {
+		t.Fatalf("failed on test case 3")
+	}
+	l.RemoveAll()
+	l.Update(func(ba *BitArray) { ba.SetRange(10, 20) })
+	var n int
+	l.View(func(ba *BitArray) { n = ba.Count() })
+	if n != 10 {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestLockedBitArrayLinearizable(t *testing.T) {
+	// counts never see a SetAll or RemoveAll half done
+	l := NewLocked(1 << 14)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 200; n++ {
+			l.SetAll()
+			l.RemoveAll()
+		}
+	}()
+	for n := 0; n < 200; n++ {
+		if c := l.Count(); c != 0 && c != 1<<14 {
+			t.Fatalf("failed on test case 1")
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+// ChunkTree is a Merkle tree of hashes of fixed-size chunks of BitArray.
+//
+// Replicas find the chunks they differ in by exchanging tree levels from
+// the root down: a replica sends hashes of the nodes asked for, the other
+// one compares them with its own with Descend and asks for the children of
+// differing nodes only. Reconciliation then transfers differing chunks
+// instead of the whole array. Hashes are not cryptographic.
+type ChunkTree struct {
+	chunkBits int
+	length    int
+	levels    [][]uint64 // levels[0] holds the root, the last one chunks
+}
+
+// ChunkTree returns a ChunkTree of BitArray with chunks of chunkBits,
+// rounded up to a multiple of 64. It sees concurrent writes partially.
+func (s *BitArray) ChunkTree(chunkBits int) *ChunkTree {
+	words := (chunkBits + 63) / 64
+	if words < 1 {
+		words = 1
+	}
+	t := ChunkTree{chunkBits: words * 64, length: s.Len()}
+	n := (len(s.data) + words - 1) / words
+	if n == 0 {
+		n = 1
+	}
+	leaves := make([]uint64, n)
+	for c := range leaves {
+		h := mix64(uint64(c) + 0x9e3779b97f4a7c15)
+		for i := c * words; i < (c+1)*words && i < len(s.data); i++ {
+			h = mix64(h ^ s.word(i))
+		}
+		leaves[c] = h
+	}
+	t.levels = [][]uint64{leaves}
+	for level := leaves; len(level) > 1; {
+		up := make([]uint64, (len(level)+1)/2)
+		for i := range up {
+			h := mix64(level[2*i])
+			if 2*i+1 < len(level) {
+				h = mix64(h ^ level[2*i+1] + 1)
+			}
+			up[i] = h
+		}
+		t.levels = append([][]uint64{up}, t.levels...)
+		level = up
+	}
+	return &t
+}
+
+// Depth returns the number of levels, chunks are at level Depth-1
+func (t *ChunkTree) Depth() int {
+	return len(t.levels)
+}
+
+// Root returns the root hash
+func (t *ChunkTree) Root() uint64 {
+	return t.levels[0][0]
+}
+
+// Chunks returns the number of chunks
+func (t *ChunkTree) Chunks() int {
+	return len(t.levels[len(t.levels)-1])
+}
+
+// ChunkRange returns bits [from, to) of chunk
+func (t *ChunkTree) ChunkRange(chunk int) (from, to int) {
+	from = chunk * t.chunkBits
+	to = from + t.chunkBits
+	if to > t.length {
+		to = t.length
+	}
+	return from, to
+}
+
+// Hashes returns hashes of nodes at level, nodes outside of it hash to 0
+func (t *ChunkTree) Hashes(level int, nodes []int) []uint64 {
+	res := make([]uint64, len(nodes))
+	for i, n := range nodes {
+		if level >= 0 && level < len(t.levels) && n >= 0 && n < len(t.levels[level]) {
+			res[i] = t.levels[level][n]
+		}
+	}
+	return res
+}
+
+// Descend compares remote hashes of nodes at level with the local ones and
+// returns the children at level+1 of differing nodes to ask for next, or
+// the differing chunks themselves at the chunk level
+func (t *ChunkTree) Descend(level int, nodes []int, remote []uint64) []int {
+	local := t.Hashes(level, nodes)
+	var res []int
+	for i, n := range nodes {
+		if i < len(remote) && local[i] == remote[i] {
+			continue
+		}
+		if level >= len(t.levels)-1 {
+			res = append(res, n)
+			continue
+		}
+		for _, c := range []int{2 * n, 2*n + 1} {
+			if c < len(t.levels[level+1]) {
+				res = append(res, c)
+			}
+		}
+	}
+	return res
+}
+
+// DivergentChunks runs the exchange between two trees of replicas and
+// returns the chunks they differ in, trees must have the same length and
+// chunk size
+func DivergentChunks(a, b *ChunkTree) ([]int, error) {
+	if a.length != b.length || a.chunkBits != b.chunkBits {
+		return nil, ErrLengthMismatch
+	}
+	nodes := []int{0}
+	for level := 0; level < a.Depth() && len(nodes) > 0; level++ {
+		next := a.Descend(level, nodes, b.Hashes(level, nodes))
+		if level == a.Depth()-1 {
+			return next, nil
+		}
+		nodes = next
+	}
+	return nil, nil
+}
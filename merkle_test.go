@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChunkTree(t *testing.T) {
+	a := New(100000, false)
+	for i := 0; i < a.Len(); i += 7 {
+		a.Set(i)
+	}
+	b := a.Clone()
+	ta, tb := a.ChunkTree(4096), b.ChunkTree(4096)
+	if ta.Chunks() != 25 || ta.Depth() != 6 || ta.Root() != tb.Root() {
+		t.Fatalf("failed on test case 1")
+	}
+	if got, err := DivergentChunks(ta, tb); err != nil || len(got) != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+
+	b.Remove(7)
+	b.Set(50000)
+	b.Set(99999)
+	tb = b.ChunkTree(4096)
+	got, err := DivergentChunks(ta, tb)
+	if err != nil || len(got) != 3 || got[0] != 0 || got[1] != 12 || got[2] != 24 || ta.Root() == tb.Root() {
+		t.Fatalf("failed on test case 3")
+	}
+	// transferring the differing chunks reconciles the replicas
+	for _, c := range got {
+		from, to := tb.ChunkRange(c)
+		for i := from; i < to; i++ {
+			if b.Get(i) {
+				a.Set(i)
+			} else {
+				a.Remove(i)
+			}
+		}
+	}
+	if from, to := tb.ChunkRange(24); from != 98304 || to != 100000 {
+		t.Fatalf("failed on test case 4")
+	}
+	if a.ChunkTree(4096).Root() != tb.Root() {
+		t.Fatalf("failed on test case 5")
+	}
+
+	if _, err = DivergentChunks(ta, b.ChunkTree(1000)); !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("failed on test case 6")
+	}
+	if e := New(0, false).ChunkTree(64); e.Chunks() != 1 || e.Depth() != 1 {
+		t.Fatalf("failed on test case 7")
+	}
+	if h := ta.Hashes(1, []int{0, 5}); h[0] == 0 || h[1] != 0 {
+		t.Fatalf("failed on test case 8")
+	}
+}
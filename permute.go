@@ -0,0 +1,39 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "math/bits"
+
+// ForEachSetPermuted calls fn for set bits in a pseudo-random order
+// determined by seed until it returns false.
+//
+// Words are visited in the order of a full period linear congruential
+// generator over the next power of two of the word count, and bits of a
+// word starting from a seed dependent offset, so workers sharing a bitmap
+// with different seeds start at different places. The order is the same
+// for the same seed and length. Bits written during the walk may or may
+// not be visited.
+func (s *BitArray) ForEachSetPermuted(seed uint64, fn func(index int) bool) {
+	n := len(s.data)
+	if n == 0 {
+		return
+	}
+	m := uint64(1) << bits.Len(uint(n-1))
+	// a = 1 mod 4 and odd c give a full period modulo a power of two
+	a := mix64(seed)<<2 | 1
+	c := mix64(seed+0x9e3779b97f4a7c15) | 1
+	x := mix64(^seed)
+	rot := int(x >> 58)
+	for k := uint64(0); k < m; k++ {
+		x = (a*x + c) & (m - 1)
+		if x >= uint64(n) {
+			continue
+		}
+		base := int(x) << 6
+		for v := bits.RotateLeft64(s.word(int(x)), -rot); v != 0; v &= v - 1 {
+			if !fn(base + (bits.TrailingZeros64(v)+rot)&0x3f) {
+				return
+			}
+		}
+	}
+}
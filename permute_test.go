@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestBitArrayForEachSetPermuted(t *testing.T) {
+	for _, length := range []int{0, 1, 64, 65, 1000, 5000} {
+		s := New(length, true)
+		for i := 0; i < length; i += 3 {
+			s.Set(i)
+		}
+		collect := func(seed uint64) []int {
+			var res []int
+			s.ForEachSetPermuted(seed, func(i int) bool {
+				res = append(res, i)
+				return true
+			})
+			return res
+		}
+		a, b, c := collect(1), collect(1), collect(2)
+		seen := New(length, false)
+		for _, i := range a {
+			if !s.Get(i) || !seen.SetChanged(i) {
+				t.Fatalf("failed on test case 1")
+			}
+		}
+		if len(a) != s.Count() || len(b) != len(a) || len(c) != len(a) {
+			t.Fatalf("failed on test case 2")
+		}
+		same, sorted := true, true
+		for i := range a {
+			same = same && a[i] == b[i]
+			sorted = sorted && (i == 0 || a[i-1] < a[i])
+		}
+		if !same {
+			t.Fatalf("failed on test case 3")
+		}
+		if length >= 1000 && (sorted || a[0] == c[0]) {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+
+	s := New(1000, false)
+	s.SetAll()
+	var n int
+	s.ForEachSetPermuted(7, func(int) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Fatalf("failed on test case 5")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// PopcountStrategy selects how Count counts bits of words
+type PopcountStrategy int32
+
+const (
+	// PopcountSWAR counts with the shift-and-add sequence, the default
+	PopcountSWAR PopcountStrategy = iota
+	// PopcountTable looks up counts of 16-bit halves of words in a table,
+	// for architectures and emulators slow at multiplication and lacking
+	// a popcount instruction
+	PopcountTable
+	// PopcountNative uses math/bits, a single instruction where available
+	PopcountNative
+)
+
+var popcount atomic.Int32
+
+// SetPopcountStrategy selects the strategy of all BitArrays
+func SetPopcountStrategy(p PopcountStrategy) {
+	if p == PopcountTable {
+		popTableOnce.Do(initPopTable)
+	}
+	popcount.Store(int32(p))
+}
+
+var (
+	popTable     [1 << 16]uint8
+	popTableOnce sync.Once
+)
+
+func initPopTable() {
+	for i := 1; i < len(popTable); i++ {
+		popTable[i] = popTable[i>>1] + uint8(i&1)
+	}
+}
+
+func (s *BitArray) countTable() int {
+	var cnt int
+	for i := range s.data {
+		if v := s.word(i); v > 0 {
+			cnt += int(popTable[v&0xffff]) + int(popTable[v>>16&0xffff]) +
+				int(popTable[v>>32&0xffff]) + int(popTable[v>>48])
+		}
+	}
+	return cnt
+}
+
+func (s *BitArray) countNative() int {
+	var cnt int
+	for i := range s.data {
+		cnt += bits.OnesCount64(s.word(i))
+	}
+	return cnt
+}
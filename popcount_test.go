@@ -0,0 +1,34 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestPopcountStrategy(t *testing.T) {
+	defer SetPopcountStrategy(PopcountSWAR)
+	for _, concurrent := range []bool{false, true} {
+		s := New(1000, concurrent)
+		for i := 0; i < 1000; i += 3 {
+			s.Set(i)
+		}
+		s.Set(998)
+		for n, p := range []PopcountStrategy{PopcountSWAR, PopcountTable, PopcountNative} {
+			SetPopcountStrategy(p)
+			if s.Count() != 335 {
+				t.Fatalf("failed on test case %d", n+1)
+			}
+		}
+	}
+}
+
+func BenchmarkCountTable(b *testing.B) {
+	defer SetPopcountStrategy(PopcountSWAR)
+	SetPopcountStrategy(PopcountTable)
+	BenchmarkCountSetAll(b)
+}
+
+func BenchmarkCountNative(b *testing.B) {
+	defer SetPopcountStrategy(PopcountSWAR)
+	SetPopcountStrategy(PopcountNative)
+	BenchmarkCountSetAll(b)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewFromRangeString returns an instantiated BitArray with bits of a
+// comma separated list of indices and inclusive ranges like "1-5,9,20-30"
+// set, its length is the highest index plus one. Spaces around items are
+// ignored. Malformed lists fail with ErrSyntax.
+func NewFromRangeString(list string, concurrent bool) (*BitArray, error) {
+	type span struct{ from, to int }
+	var spans []span
+	length := 0
+	if strings.TrimSpace(list) != "" {
+		for _, item := range strings.Split(list, ",") {
+			item = strings.TrimSpace(item)
+			lo, hi, isRange := strings.Cut(item, "-")
+			from, err := parseRangeIndex(lo, item)
+			if err != nil {
+				return nil, err
+			}
+			to := from
+			if isRange {
+				if to, err = parseRangeIndex(hi, item); err != nil {
+					return nil, err
+				}
+			}
+			if to < from {
+				return nil, fmt.Errorf("%w: descending range %q", ErrSyntax, item)
+			}
+			// the length in words must not overflow
+			if to > maxInt-64 {
+				return nil, fmt.Errorf("%w: index out of range in %q", ErrSyntax, item)
+			}
+			spans = append(spans, span{from, to + 1})
+			if to+1 > length {
+				length = to + 1
+			}
+		}
+	}
+	res := New(length, concurrent)
+	for _, sp := range spans {
+		res.SetRange(sp.from, sp.to)
+	}
+	return res, nil
+}
+
+// parseRangeIndex parses a non-negative index of item
+func parseRangeIndex(s, item string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s[0] == '+' {
+		return 0, fmt.Errorf("%w: bad item %q", ErrSyntax, item)
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%w: bad item %q", ErrSyntax, item)
+	}
+	return v, nil
+}
+
+// RangeString returns set bits as a comma separated list of indices and
+// inclusive ranges like "1-5,9,20-30", the inverse of NewFromRangeString
+func (s *BitArray) RangeString() string {
+	return s.RangeStringN(-1)
+}
+
+// RangeStringN is RangeString limited to about n bytes, a negative n is
+// unlimited. Items past the limit are replaced with ",...".
+func (s *BitArray) RangeStringN(n int) string {
+	var buf []byte
+	s.forEachRun(func(from, to int) bool {
+		mark := len(buf)
+		if mark > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(from), 10)
+		if to-1 > from {
+			buf = append(buf, '-')
+			buf = strconv.AppendInt(buf, int64(to-1), 10)
+		}
+		if n >= 0 && len(buf) > n {
+			buf = append(buf[:mark], ",..."...)
+			if mark == 0 {
+				buf = buf[1:]
+			}
+			return false
+		}
+		return true
+	})
+	return string(buf)
+}
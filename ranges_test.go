@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewFromRangeString(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba, err := NewFromRangeString("1-5, 9 ,20 - 30,63-64,200", concurrent)
+		if err != nil || ba.Len() != 201 || ba.Count() != 5+1+11+2+1 {
+			t.Fatalf("failed on test case 1: %v", err)
+		}
+		for _, i := range []int{1, 5, 9, 20, 30, 63, 64, 200} {
+			if !ba.Get(i) {
+				t.Fatalf("failed on test case 2")
+			}
+		}
+		if ba.Get(0) || ba.Get(6) || ba.Get(31) || ba.Get(65) {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+	ba, err := NewFromRangeString("0-199,100-149", false)
+	if err != nil || ba.Len() != 200 || ba.Count() != 200 {
+		t.Fatalf("failed on test case 4: %v", err)
+	}
+	if ba, err = NewFromRangeString(" ", false); err != nil || ba.Len() != 0 {
+		t.Fatalf("failed on test case 5: %v", err)
+	}
+	for _, bad := range []string{"1,", "a", "5-3", "-3", "1-", "1-2-3", "+4", "1;2", "99999999999999999999",
+		"9223372036854775807", "9223372036854775806", "0-9223372036854775744"} {
+		if _, err = NewFromRangeString(bad, false); !errors.Is(err, ErrSyntax) {
+			t.Fatalf("failed on test case 6: %q", bad)
+		}
+	}
+}
+
+func TestBitArrayRangeString(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(300, concurrent)
+		if ba.RangeString() != "" {
+			t.Fatalf("failed on test case 1")
+		}
+		for _, r := range [][2]int{{1, 6}, {9, 10}, {20, 31}, {63, 65}, {128, 300}} {
+			for i := r[0]; i < r[1]; i++ {
+				ba.Set(i)
+			}
+		}
+		want := "1-5,9,20-30,63-64,128-299"
+		if got := ba.RangeString(); got != want {
+			t.Fatalf("failed on test case 2: %s", got)
+		}
+		res, err := NewFromRangeString(want, false)
+		if err != nil || res.DiffCount(ba) != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+		if got := ba.RangeStringN(12); got != "1-5,9,20-30,..." {
+			t.Fatalf("failed on test case 4: %s", got)
+		}
+		if got := ba.RangeStringN(2); got != "..." {
+			t.Fatalf("failed on test case 5: %s", got)
+		}
+		if got := ba.RangeStringN(100); got != want {
+			t.Fatalf("failed on test case 6: %s", got)
+		}
+	}
+}
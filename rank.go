@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// rankBlockWords is the number of words per block of the rank index,
+// a count per 2048 bits adds about 3% of memory
+const rankBlockWords = 32
+
+// rankIndex holds counts of set bits before each block of words
+type rankIndex struct {
+	counts []int
+	total  int
+}
+
+// BuildRankIndex builds an index of cumulative counts of set bits per
+// block of words, so Rank takes constant time and Select a binary search.
+// Any write drops the index and Rank and Select fall back to scans until it
+// is built again. It must not be called concurrently with writers.
+func (s *BitArray) BuildRankIndex() {
+	idx := rankIndex{counts: make([]int, (len(s.data)+rankBlockWords-1)/rankBlockWords)}
+	for i := range s.data {
+		if i%rankBlockWords == 0 {
+			idx.counts[i/rankBlockWords] = idx.total
+		}
+		idx.total += bits.OnesCount64(s.word(i))
+	}
+	s.rank.Store(&idx)
+}
+
+// Rank returns count of set bits in [0, index)
+func (s *BitArray) Rank(index int) int {
+	idx := s.rank.Load()
+	if idx == nil {
+		return s.CountRange(0, index)
+	}
+	if index <= 0 {
+		return 0
+	}
+	if index >= s.Len() {
+		return idx.total
+	}
+	b := index / 64 / rankBlockWords
+	return idx.counts[b] + s.CountRange(b*rankBlockWords*64, index)
+}
+
+// Select returns index of the set bit of rank k, the (k+1)-th set bit,
+// ok is false when fewer bits are set
+func (s *BitArray) Select(k int) (int, bool) {
+	if k < 0 {
+		return -1, false
+	}
+	from := 0
+	if idx := s.rank.Load(); idx != nil {
+		if k >= idx.total {
+			return -1, false
+		}
+		// the last block starting with at most k set bits before it
+		b := sort.Search(len(idx.counts), func(b int) bool { return idx.counts[b] > k }) - 1
+		k -= idx.counts[b]
+		from = b * rankBlockWords
+	}
+	for i := from; i < len(s.data); i++ {
+		v := s.word(i)
+		if c := bits.OnesCount64(v); k >= c {
+			k -= c
+			continue
+		}
+		for ; k > 0; k-- {
+			v &= v - 1
+		}
+		return i<<6 + bits.TrailingZeros64(v), true
+	}
+	return -1, false
+}
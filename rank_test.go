@@ -0,0 +1,48 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestBitArrayRankSelect(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(100000, concurrent)
+		var set []int
+		for i := 0; i < ba.Len(); i += 1 + i%97 {
+			ba.Set(i)
+			set = append(set, i)
+		}
+		for _, indexed := range []bool{false, true} {
+			if indexed {
+				ba.BuildRankIndex()
+			}
+			for k, i := range set {
+				if ba.Rank(i) != k || ba.Rank(i+1) != k+1 {
+					t.Fatalf("failed on test case 1")
+				}
+				if got, ok := ba.Select(k); !ok || got != i {
+					t.Fatalf("failed on test case 2")
+				}
+			}
+			if _, ok := ba.Select(len(set)); ok {
+				t.Fatalf("failed on test case 3")
+			}
+			if ba.Rank(-1) != 0 || ba.Rank(ba.Len()+5) != len(set) {
+				t.Fatalf("failed on test case 4")
+			}
+		}
+		// writes drop the index
+		ba.Set(1)
+		if ba.rank.Load() != nil || ba.Rank(2) != 2 {
+			t.Fatalf("failed on test case 5")
+		}
+		if i, ok := ba.Select(1); !ok || i != 1 {
+			t.Fatalf("failed on test case 6")
+		}
+	}
+	empty := New(0, false)
+	empty.BuildRankIndex()
+	if _, ok := empty.Select(0); ok || empty.Rank(0) != 0 {
+		t.Fatalf("failed on test case 7")
+	}
+}
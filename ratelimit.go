@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a sliding window rate limiter for integer keys.
+//
+// The window is split into time slots with one BitArray per slot marking
+// keys allowed in it, so a key is allowed at most once per slot and at
+// most limit times per window. Memory is bounded by keys bits per slot.
+type RateLimiter struct {
+	mu    sync.Mutex
+	slot  time.Duration
+	limit int
+	slots []*BitArray // ring of slot bitmaps
+	cur   int64       // number of the current slot since the epoch
+}
+
+// NewRateLimiter returns an instantiated RateLimiter for keys [0, keys)
+// allowing limit events per key in every window, window is rounded up
+// to whole slots.
+func NewRateLimiter(keys int, window, slot time.Duration, limit int) *RateLimiter {
+	if slot <= 0 {
+		slot = time.Second
+	}
+	n := int((window + slot - 1) / slot)
+	if n < 1 {
+		n = 1
+	}
+	res := RateLimiter{
+		slot:  slot,
+		limit: limit,
+		slots: make([]*BitArray, n),
+	}
+	for i := range res.slots {
+		res.slots[i] = New(keys, false)
+	}
+	return &res
+}
+
+// Allow reports whether an event of key is allowed now and records it
+func (r *RateLimiter) Allow(key int) bool {
+	return r.AllowAt(key, time.Now())
+}
+
+// AllowAt reports whether an event of key is allowed at t and records it,
+// times before the latest seen one count as the latest
+func (r *RateLimiter) AllowAt(key int, t time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rotate(t.UnixNano() / int64(r.slot))
+
+	cur := r.slots[r.cur%int64(len(r.slots))]
+	if !cur.SetChanged(key) {
+		// marked in this slot already or out of range
+		return false
+	}
+	var cnt int
+	for _, s := range r.slots {
+		if s.Get(key) {
+			cnt++
+		}
+	}
+	if cnt > r.limit {
+		cur.Remove(key)
+		return false
+	}
+	return true
+}
+
+// rotate advances the window to slot n, clearing expired slots
+func (r *RateLimiter) rotate(n int64) {
+	if n <= r.cur {
+		return
+	}
+	size := int64(len(r.slots))
+	from := r.cur + 1
+	if n-r.cur > size {
+		from = n - size + 1
+	}
+	for i := from; i <= n; i++ {
+		r.slots[i%size].RemoveAll()
+	}
+	r.cur = n
+}
+
+// MemoryBytes returns size of slot bitmaps in bytes
+func (r *RateLimiter) MemoryBytes() int {
+	return len(r.slots) * len(r.slots[0].data) * 8
+}
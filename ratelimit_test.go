@@ -0,0 +1,45 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(1000, 10*time.Second, time.Second, 3)
+	start := time.Unix(1000, 0)
+
+	if !r.AllowAt(7, start) {
+		t.Fatalf("failed on test case 1")
+	}
+	// once per slot
+	if r.AllowAt(7, start.Add(500*time.Millisecond)) {
+		t.Fatalf("failed on test case 2")
+	}
+	if !r.AllowAt(7, start.Add(time.Second)) || !r.AllowAt(7, start.Add(2*time.Second)) {
+		t.Fatalf("failed on test case 3")
+	}
+	// limit per window
+	if r.AllowAt(7, start.Add(5*time.Second)) {
+		t.Fatalf("failed on test case 4")
+	}
+	if !r.AllowAt(8, start.Add(5*time.Second)) {
+		t.Fatalf("failed on test case 5")
+	}
+	// the first event left the window
+	if !r.AllowAt(7, start.Add(10*time.Second)) || r.AllowAt(7, start.Add(10500*time.Millisecond)) {
+		t.Fatalf("failed on test case 6")
+	}
+	// whole window expired
+	if !r.AllowAt(7, start.Add(time.Hour)) {
+		t.Fatalf("failed on test case 7")
+	}
+	if r.AllowAt(1000, start.Add(time.Hour)) || r.AllowAt(-1, start.Add(time.Hour)) {
+		t.Fatalf("failed on test case 8")
+	}
+	if r.MemoryBytes() != 10*16*8 {
+		t.Fatalf("failed on test case 9")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ReadMostly is a BitArray for read dominated workloads.
+//
+// Readers load an immutable snapshot through an atomic pointer, so reads
+// are wait-free and always see a consistent state. Writers copy the
+// snapshot, apply a batch of updates and swap the copy in, which costs a
+// copy of the array per batch. It is safe for concurrent usage.
+type ReadMostly struct {
+	mu   sync.Mutex // serializes writers
+	snap atomic.Pointer[BitArray]
+}
+
+// NewReadMostly returns an instantiated ReadMostly of length bits
+func NewReadMostly(length int) *ReadMostly {
+	var res ReadMostly
+	res.snap.Store(New(length, false))
+	return &res
+}
+
+// Load returns the current snapshot, it must not be modified
+func (r *ReadMostly) Load() *BitArray {
+	return r.snap.Load()
+}
+
+// Get returns bit value at index of the current snapshot
+func (r *ReadMostly) Get(index int) bool {
+	return r.snap.Load().Get(index)
+}
+
+// Count returns count of set bits of the current snapshot
+func (r *ReadMostly) Count() int {
+	return r.snap.Load().Count()
+}
+
+// Len returns length in bits
+func (r *ReadMostly) Len() int {
+	return r.snap.Load().Len()
+}
+
+// Update applies fn to a copy of the current snapshot and publishes it,
+// readers see either none or all of the updates of fn
+func (r *ReadMostly) Update(fn func(ba *BitArray)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := r.snap.Load().Clone()
+	fn(next)
+	r.snap.Store(next)
+}
+
+// Set sets bit at index, a batch of one update
+func (r *ReadMostly) Set(index int) {
+	r.Update(func(ba *BitArray) { ba.Set(index) })
+}
+
+// Remove removes bit at index, a batch of one update
+func (r *ReadMostly) Remove(index int) {
+	r.Update(func(ba *BitArray) { ba.Remove(index) })
+}
+
+// Store publishes a copy of ba as the current snapshot
+func (r *ReadMostly) Store(ba *BitArray) {
+	next := ba.Clone()
+	r.mu.Lock()
+	r.snap.Store(next)
+	r.mu.Unlock()
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestReadMostly(t *testing.T) {
+	r := NewReadMostly(100)
+	old := r.Load()
+	r.Set(5)
+	r.Update(func(ba *BitArray) {
+		ba.Set(6)
+		ba.Set(7)
+	})
+	if r.Len() != 100 || r.Count() != 3 || !r.Get(6) || old.Count() != 0 {
+		t.Fatalf("failed on test case 1")
+	}
+	r.Remove(5)
+	if r.Get(5) || r.Count() != 2 {
+		t.Fatalf("failed on test case 2")
+	}
+	ba := New(100, true)
+	ba.Set(1)
+	r.Store(ba)
+	ba.Set(2)
+	if r.Count() != 1 || !r.Get(1) {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestReadMostlyConsistentReads(t *testing.T) {
+	r := NewReadMostly(1 << 12)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// every batch sets a pair of bits
+		for i := 0; i < 1<<12; i += 2 {
+			r.Update(func(ba *BitArray) {
+				ba.Set(i)
+				ba.Set(i + 1)
+			})
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if r.Count()%2 != 0 {
+			t.Fatalf("failed on test case 1")
+		}
+	}
+	wg.Wait()
+	if r.Count() != 1<<12 {
+		t.Fatalf("failed on test case 2")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+// Pos returns index of the first bit equal to value within bytes
+// [startByte, endByte], mirroring Redis BITPOS with both bounds given.
+// Byte j holds bits [8j, 8j+8), negative bounds count from the last byte
+// and bits past the length in the last byte read as 0, as in a Redis
+// string. Pos returns -1 when no such bit is found in the range, except
+// that an empty BitArray reports 0 for a clear bit like a missing key.
+func (s *BitArray) Pos(value bool, startByte, endByte int) int {
+	return s.pos(value, startByte, endByte, true)
+}
+
+// PosFrom is Pos with an open end, mirroring Redis BITPOS with the start
+// only: when all bits from startByte on are set, a search for a clear bit
+// returns the first index past the last byte.
+func (s *BitArray) PosFrom(value bool, startByte int) int {
+	return s.pos(value, startByte, -1, false)
+}
+
+// CountBytes returns count of set bits within bytes [startByte, endByte],
+// mirroring Redis BITCOUNT with a byte range: byte j holds bits
+// [8j, 8j+8) and negative bounds count from the last byte.
+func (s *BitArray) CountBytes(startByte, endByte int) int {
+	from, to, ok := s.byteRange(startByte, endByte)
+	if !ok {
+		return 0
+	}
+	return s.CountRange(from, to)
+}
+
+// byteRange returns bit range [from, to) of bytes [start, end] normalized
+// the way Redis does, ok is false for an empty range
+func (s *BitArray) byteRange(start, end int) (from, to int, ok bool) {
+	size := (s.Len() + 7) / 8
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end {
+		return 0, 0, false
+	}
+	return start * 8, (end + 1) * 8, true
+}
+
+func (s *BitArray) pos(value bool, start, end int, endGiven bool) int {
+	n := s.Len()
+	if n == 0 {
+		if value {
+			return -1
+		}
+		return 0
+	}
+	from, to, ok := s.byteRange(start, end)
+	if !ok {
+		return -1
+	}
+	if value {
+		if i := s.nextSet(from); i >= 0 && i < to {
+			return i
+		}
+		return -1
+	}
+	i := s.nextClear(from)
+	if i < 0 {
+		// padding bits past the length are clear
+		i = n
+	}
+	if i < to {
+		return i
+	}
+	if !endGiven {
+		return to
+	}
+	return -1
+}
+
+// BitOpAnd stores the intersection of srcs in dst and returns its length
+// in bytes, mirroring Redis BITOP AND: dst gets the length of the longest
+// source, shorter sources read as zero padded. dst may be one of srcs, it
+// is replaced, which is not safe for concurrent usage of dst.
+func BitOpAnd(dst *BitArray, srcs ...*BitArray) int {
+	return bitOp(dst, srcs, func(a, b uint64) uint64 { return a & b })
+}
+
+// BitOpOr stores the union of srcs in dst and returns its length in bytes,
+// mirroring Redis BITOP OR, see BitOpAnd
+func BitOpOr(dst *BitArray, srcs ...*BitArray) int {
+	return bitOp(dst, srcs, func(a, b uint64) uint64 { return a | b })
+}
+
+// BitOpXor stores the symmetric difference of srcs in dst and returns its
+// length in bytes, mirroring Redis BITOP XOR, see BitOpAnd
+func BitOpXor(dst *BitArray, srcs ...*BitArray) int {
+	return bitOp(dst, srcs, func(a, b uint64) uint64 { return a ^ b })
+}
+
+// BitOpNot stores the complement of src in dst and returns its length in
+// bytes, mirroring Redis BITOP NOT. Bits past the length of src, which
+// Redis would set in the last byte, are kept clear.
+func BitOpNot(dst, src *BitArray) int {
+	n := src.Len()
+	data := make([]uint64, len(src.data))
+	for i := range data {
+		data[i] = ^src.word(i)
+	}
+	if len(data) > 0 {
+		data[len(data)-1] &= tailMask(n)
+	}
+	dst.replace(data, n)
+	return (n + 7) / 8
+}
+
+func bitOp(dst *BitArray, srcs []*BitArray, op func(a, b uint64) uint64) int {
+	var n, words int
+	for _, src := range srcs {
+		if src.Len() > n {
+			n, words = src.Len(), len(src.data)
+		}
+	}
+	data := make([]uint64, words)
+	for j, src := range srcs {
+		for i := range data {
+			var v uint64
+			if i < len(src.data) {
+				v = src.word(i)
+			}
+			if j == 0 {
+				data[i] = v
+			} else {
+				data[i] = op(data[i], v)
+			}
+		}
+	}
+	dst.replace(data, n)
+	return (n + 7) / 8
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestPos(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(24, concurrent)
+		if s.Pos(true, 0, -1) != -1 || s.Pos(false, 0, -1) != 0 {
+			t.Fatalf("failed on test case 1")
+		}
+		for i := 0; i < 8; i++ {
+			s.Set(i)
+		}
+		s.Set(12)
+		if s.Pos(true, 0, -1) != 0 || s.Pos(true, 1, -1) != 12 || s.Pos(true, -1, -1) != -1 {
+			t.Fatalf("failed on test case 2")
+		}
+		if s.Pos(false, 0, 0) != -1 || s.Pos(false, 0, 1) != 8 || s.Pos(false, -2, 2) != 8 {
+			t.Fatalf("failed on test case 3")
+		}
+		if s.Pos(true, 2, 1) != -1 || s.Pos(true, -100, 100) != 0 {
+			t.Fatalf("failed on test case 4")
+		}
+		for i := 0; i < 24; i++ {
+			s.Set(i)
+		}
+		// no clear bit within the range vs open end
+		if s.Pos(false, 0, -1) != -1 || s.PosFrom(false, 0) != 24 || s.PosFrom(false, 1) != 24 {
+			t.Fatalf("failed on test case 5")
+		}
+		if New(0, concurrent).Pos(false, 3, 5) != 0 || New(0, concurrent).PosFrom(true, 0) != -1 {
+			t.Fatalf("failed on test case 6")
+		}
+		// padding of the last byte reads as clear
+		p := New(13, concurrent)
+		for i := 0; i < 13; i++ {
+			p.Set(i)
+		}
+		if p.Pos(false, 0, -1) != 13 || p.Pos(false, 0, 0) != -1 || p.PosFrom(false, 0) != 13 {
+			t.Fatalf("failed on test case 7")
+		}
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	a, b, c := New(100, false), New(30, true), New(0, false)
+	a.Set(3)
+	a.Set(20)
+	a.Set(90)
+	b.Set(3)
+	b.Set(7)
+	dst := New(10, false)
+	if BitOpAnd(dst, a, b) != 13 || dst.Len() != 100 || dst.Count() != 1 || !dst.Get(3) {
+		t.Fatalf("failed on test case 1")
+	}
+	if BitOpOr(dst, a, b) != 13 || dst.Count() != 4 || !dst.Get(90) || !dst.Get(7) {
+		t.Fatalf("failed on test case 2")
+	}
+	if BitOpXor(dst, a, b, c) != 13 || dst.Count() != 3 || dst.Get(3) {
+		t.Fatalf("failed on test case 3")
+	}
+	// zero padding of shorter operands
+	if BitOpAnd(dst, a, c) != 13 || dst.Count() != 0 {
+		t.Fatalf("failed on test case 4")
+	}
+	if BitOpNot(b, b) != 4 || b.Len() != 30 || b.Count() != 28 || b.Get(3) || !b.Get(29) {
+		t.Fatalf("failed on test case 5")
+	}
+	// dst among sources
+	if BitOpOr(a, a, b) != 13 || a.Count() != 30 || !a.Get(3) || !a.Get(90) {
+		t.Fatalf("failed on test case 6")
+	}
+	if BitOpOr(dst) != 0 || dst.Len() != 0 {
+		t.Fatalf("failed on test case 7")
+	}
+}
+
+func TestCountBytes(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(20, concurrent)
+		for _, i := range []int{0, 7, 8, 19} {
+			s.Set(i)
+		}
+		if s.CountBytes(0, -1) != 4 || s.CountBytes(0, 0) != 2 || s.CountBytes(1, 1) != 1 ||
+			s.CountBytes(-1, -1) != 1 || s.CountBytes(-2, 100) != 2 || s.CountBytes(-100, 0) != 2 {
+			t.Fatalf("failed on test case 1")
+		}
+		if s.CountBytes(2, 1) != 0 || s.CountBytes(5, 10) != 0 || New(0, concurrent).CountBytes(0, -1) != 0 {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+}
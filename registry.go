@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry is a set of named BitArrays in concurrent mode, like keys of a
+// Redis database. It is safe for concurrent usage.
+type Registry struct {
+	mu     sync.RWMutex
+	length int
+	items  map[string]*BitArray
+}
+
+// NewRegistry returns an empty Registry creating BitArrays of length bits
+func NewRegistry(length int) *Registry {
+	return &Registry{
+		length: length,
+		items:  make(map[string]*BitArray),
+	}
+}
+
+// Length returns length in bits of BitArrays created by Registry
+func (r *Registry) Length() int {
+	return r.length
+}
+
+// Get returns BitArray of name, or nil when missing
+func (r *Registry) Get(name string) *BitArray {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.items[name]
+}
+
+// GetOrCreate returns BitArray of name, creating an empty one when missing
+func (r *Registry) GetOrCreate(name string) *BitArray {
+	if ba := r.Get(name); ba != nil {
+		return ba
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ba := r.items[name]
+	if ba == nil {
+		ba = New(r.length, true)
+		r.items[name] = ba
+	}
+	return ba
+}
+
+// Put stores ba under name, replacing the previous BitArray if any
+func (r *Registry) Put(name string, ba *BitArray) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[name] = ba
+}
+
+// Delete removes BitArray of name and reports whether it existed
+func (r *Registry) Delete(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.items[name]
+	delete(r.items, name)
+	return ok
+}
+
+// Names returns sorted names of BitArrays
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	res := make([]string, 0, len(r.items))
+	for name := range r.items {
+		res = append(res, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(100)
+	if r.Get("a") != nil || r.Length() != 100 {
+		t.Fatalf("failed on test case 1")
+	}
+	a := r.GetOrCreate("a")
+	a.Set(5)
+	if r.GetOrCreate("a") != a || a.Len() != 100 || !r.Get("a").Get(5) {
+		t.Fatalf("failed on test case 2")
+	}
+	r.Put("b", New(10, true))
+	if names := r.Names(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("failed on test case 3")
+	}
+	if !r.Delete("a") || r.Delete("a") || r.Get("a") != nil {
+		t.Fatalf("failed on test case 4")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "image"
+
+// RenderImage rasterizes BitArray into a grayscale image of the given width
+// and at most width pixels high, width is clamped to the length of BitArray.
+//
+// Pixels go row by row in index order, every pixel covers an equal share of
+// bits and its brightness is the density of set bits in the share.
+func (s *BitArray) RenderImage(width int) image.Image {
+	n := s.Len()
+	width = clampWidth(width, n)
+	per := 1
+	if width <= n/width { // width*width does not overflow
+		per = (n + width*width - 1) / (width * width)
+	}
+	return s.render(width, per)
+}
+
+// RenderBitImage rasterizes BitArray into an image of the given width with
+// one pixel per bit, white for set and black for clear bits. Like in
+// RenderImage width is clamped to the length of BitArray.
+func (s *BitArray) RenderBitImage(width int) image.Image {
+	return s.render(clampWidth(width, s.Len()), 1)
+}
+
+// clampWidth returns image width in [1, max(n, 1)], wider images would
+// only add blank columns to a single row
+func clampWidth(width, n int) int {
+	if width > n {
+		width = n
+	}
+	if width <= 0 {
+		width = 1
+	}
+	return width
+}
+
+// render draws per bits into every pixel of an image of the given width
+func (s *BitArray) render(width, per int) *image.Gray {
+	n := s.Len()
+	pixels := (n + per - 1) / per
+	img := image.NewGray(image.Rect(0, 0, width, (pixels+width-1)/width))
+	for p := 0; p < pixels; p++ {
+		from, to := p*per, p*per+per
+		if to > n {
+			to = n
+		}
+		img.Pix[p] = uint8(255 * s.CountRange(from, to) / (to - from))
+	}
+	return img
+}
+
+// Sparkline levels, a space marks buckets without set bits
+var sparks = []rune(" ▁▂▃▄▅▆▇█")
+
+// Sparkline returns a single line density chart of BitArray split into
+// the given number of buckets, one rune per bucket.
+func (s *BitArray) Sparkline(buckets int) string {
+	n := s.Len()
+	if buckets > n {
+		buckets = n
+	}
+	if buckets <= 0 {
+		return ""
+	}
+	res := make([]rune, buckets)
+	for b := range res {
+		from, to := b*n/buckets, (b+1)*n/buckets
+		cnt := s.CountRange(from, to)
+		res[b] = sparks[(cnt*(len(sparks)-1)+to-from-1)/(to-from)]
+	}
+	return string(res)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestBitArrayRenderImage(t *testing.T) {
+	ba := New(1600, false)
+	for i := 0; i < 400; i++ {
+		ba.Set(i)
+	}
+	for i := 400; i < 800; i += 2 {
+		ba.Set(i)
+	}
+
+	img := ba.RenderImage(10)
+	if b := img.Bounds(); b.Dx() != 10 || b.Dy() != 10 {
+		t.Fatalf("failed on test case 1: %v", b)
+	}
+	// 16 bits per pixel, 25 pixels per quarter
+	if img.At(0, 0) != (color.Gray{Y: 255}) {
+		t.Fatalf("failed on test case 2")
+	}
+	if img.At(5, 2) != (color.Gray{Y: 127}) {
+		t.Fatalf("failed on test case 3: %v", img.At(5, 2))
+	}
+	if img.At(9, 9) != (color.Gray{Y: 0}) {
+		t.Fatalf("failed on test case 4")
+	}
+	// width*width overflows and is clamped
+	if b := ba.RenderImage(math.MaxInt).Bounds(); b.Dx() != 1600 || b.Dy() != 1 {
+		t.Fatalf("failed on test case 5: %v", b)
+	}
+	if b := New(0, false).RenderImage(3).Bounds(); b.Dx() != 1 || b.Dy() != 0 {
+		t.Fatalf("failed on test case 6: %v", b)
+	}
+}
+
+func TestBitArrayRenderBitImage(t *testing.T) {
+	ba := New(10, true)
+	ba.Set(1)
+	ba.Set(9)
+
+	img := ba.RenderBitImage(4)
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 3 {
+		t.Fatalf("failed on test case 1: %v", b)
+	}
+	if img.At(1, 0) != (color.Gray{Y: 255}) || img.At(0, 0) != (color.Gray{Y: 0}) {
+		t.Fatalf("failed on test case 2")
+	}
+	if img.At(1, 2) != (color.Gray{Y: 255}) || img.At(2, 2) != (color.Gray{Y: 0}) {
+		t.Fatalf("failed on test case 3")
+	}
+	if b := ba.RenderBitImage(math.MaxInt).Bounds(); b.Dx() != 10 || b.Dy() != 1 {
+		t.Fatalf("failed on test case 4: %v", b)
+	}
+}
+
+func TestBitArraySparkline(t *testing.T) {
+	ba := New(64, false)
+	for i := 0; i < 8; i++ {
+		ba.Set(i)
+	}
+	ba.Set(9)
+	for i := 48; i < 56; i += 2 {
+		ba.Set(i)
+	}
+
+	if s := ba.Sparkline(8); s != "█▁    ▄ " {
+		t.Fatalf("failed on test case 1: %q", s)
+	}
+	if s := ba.Sparkline(1000); len([]rune(s)) != 64 {
+		t.Fatalf("failed on test case 2")
+	}
+	if s := New(0, false).Sparkline(8); s != "" {
+		t.Fatalf("failed on test case 3")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	kindRibbonFilter = 3
+	ribbonFilterV1   = 1
+)
+
+// RibbonFilter is a static homogeneous ribbon filter for immutable sets of
+// uint64 keys. With r result bits it takes about 1.1 r bits per key for a
+// false positive rate close to 2^-r.
+//
+// Every key stands for a linear equation over 64 consecutive slots, the
+// filter stores a solution of all of them as r bit columns. Construction
+// never fails as all equations are homogeneous.
+type RibbonFilter struct {
+	seed  uint64
+	slots int
+	cols  []*BitArray
+}
+
+// NewRibbonFilter builds RibbonFilter of keys with r result bits,
+// from 1 to 32. Duplicates are allowed.
+func NewRibbonFilter(keys []uint64, r int) (*RibbonFilter, error) {
+	if r < 1 || r > 32 {
+		return nil, fmt.Errorf("%w: ribbon result bits %d out of range [1:32]", ErrInvalidArgument, r)
+	}
+	keys = uniqueKeys(keys)
+	f := &RibbonFilter{
+		seed:  mix64(uint64(len(keys))<<8 | uint64(r)),
+		slots: len(keys) + len(keys)/10 + 64,
+	}
+
+	// banding, rows are kept in echelon form with bit 0 set
+	rows := make([]uint64, f.slots)
+	for _, key := range keys {
+		i, c := f.equation(key)
+		for rows[i] != 0 {
+			if c ^= rows[i]; c == 0 {
+				break
+			}
+			tz := bits.TrailingZeros64(c)
+			i, c = i+tz, c>>tz
+		}
+		if c != 0 {
+			rows[i] = c
+		}
+	}
+
+	// back substitution, free slots get pseudorandom values
+	z := make([]uint32, f.slots)
+	mask := uint32(1<<r - 1)
+	for i := f.slots - 1; i >= 0; i-- {
+		if rows[i] == 0 {
+			z[i] = uint32(mix64(f.seed^uint64(i))) & mask
+			continue
+		}
+		var v uint32
+		for c := rows[i] &^ 1; c != 0; c &= c - 1 {
+			v ^= z[i+bits.TrailingZeros64(c)]
+		}
+		z[i] = v
+	}
+	f.cols = make([]*BitArray, r)
+	for k := range f.cols {
+		f.cols[k] = New(f.slots, false)
+		for i, v := range z {
+			if v>>k&1 != 0 {
+				f.cols[k].set(i)
+			}
+		}
+	}
+	return f, nil
+}
+
+// equation returns start slot and coefficients of key
+func (f *RibbonFilter) equation(key uint64) (int, uint64) {
+	h := mix64(key ^ f.seed)
+	start, _ := bits.Mul64(h, uint64(f.slots-63))
+	return int(start), mix64(h) | 1
+}
+
+// Contains reports whether key may be in the set,
+// false means it definitely is not
+func (f *RibbonFilter) Contains(key uint64) bool {
+	start, c := f.equation(key)
+	for _, col := range f.cols {
+		if bits.OnesCount64(col.bitsAt(start, 64)&c)&1 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (f *RibbonFilter) MarshalBinary() ([]byte, error) {
+	words := (f.slots + 63) / 64
+	buf := appendHeader(make([]byte, 0, headerSize+9+8*words*len(f.cols)), ribbonFilterV1, kindRibbonFilter)
+	buf = binary.LittleEndian.AppendUint64(buf, f.seed)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(f.slots))
+	buf = append(buf, uint8(len(f.cols)))
+	for _, col := range f.cols {
+		for _, v := range col.data {
+			buf = binary.LittleEndian.AppendUint64(buf, v)
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (f *RibbonFilter) UnmarshalBinary(data []byte) error {
+	if _, err := readHeader(bytes.NewReader(data), kindRibbonFilter, ribbonFilterV1); err != nil {
+		return err
+	}
+	data = data[headerSize:]
+	if len(data) < 17 {
+		return fmt.Errorf("%w: truncated", ErrCorruptData)
+	}
+	seed := binary.LittleEndian.Uint64(data)
+	slots := binary.LittleEndian.Uint64(data[8:])
+	r := int(data[16])
+	data = data[17:]
+	if slots < 64 || slots > uint64(len(data))*8 || r < 1 || r > 32 ||
+		uint64(len(data)) != (slots+63)/64*8*uint64(r) {
+		return fmt.Errorf("%w: bad length", ErrCorruptData)
+	}
+	cols := make([]*BitArray, r)
+	for k := range cols {
+		cols[k] = New(int(slots), false)
+		for i := range cols[k].data {
+			cols[k].data[i] = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		}
+		cols[k].right = int64(len(cols[k].data)) - 1
+	}
+	f.seed, f.slots, f.cols = seed, int(slots), cols
+	return nil
+}
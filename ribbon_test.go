@@ -0,0 +1,63 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRibbonFilter(t *testing.T) {
+	keys := make([]uint64, 50000)
+	for i := range keys {
+		keys[i] = uint64(i) * 7919
+	}
+
+	f, err := NewRibbonFilter(keys, 8)
+	if err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	for _, k := range keys {
+		if !f.Contains(k) {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+
+	var fp int
+	for i := 0; i < 100000; i++ {
+		if f.Contains(uint64(i)*7919 + 1) {
+			fp++
+		}
+	}
+	t.Log(fp, f.slots)
+	if fp > 600 {
+		t.Fatalf("failed on test case 3")
+	}
+
+	data, _ := f.MarshalBinary()
+	var g RibbonFilter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatalf("failed on test case 4: %v", err)
+	}
+	for _, k := range keys[:1000] {
+		if !g.Contains(k) {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+	if err := g.UnmarshalBinary(data[:len(data)-8]); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 6: %v", err)
+	}
+	if err := g.UnmarshalBinary(data[:5]); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 7: %v", err)
+	}
+}
+
+func TestRibbonFilterSmall(t *testing.T) {
+	if _, err := NewRibbonFilter(nil, 0); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("failed on test case 1")
+	}
+	f, err := NewRibbonFilter([]uint64{1, 2, 2, 3}, 1)
+	if err != nil || !f.Contains(1) || !f.Contains(2) || !f.Contains(3) {
+		t.Fatalf("failed on test case 2: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Roaring64 portable format as written by CRoaring and the Java
+// Roaring64NavigableMap: a count of 32-bit buckets, then for each bucket
+// its high 32 bits and a 32-bit Roaring bitmap of the low bits.
+const (
+	roaringNoRunCookie  = 12346
+	roaringRunCookie    = 12347
+	roaringArrayMax     = 4096
+	roaringNoOffsetRuns = 4    // run bitmaps smaller than this have no offsets
+	roaringChunkWords   = 1024 // words of a 65536 bit container
+)
+
+// MarshalRoaring64 returns set bits of BitArray in the Roaring64 portable
+// serialized form. Containers are written as arrays or bitmaps, no runs.
+func (s *BitArray) MarshalRoaring64() []byte {
+	// containers of a bucket: keys and words of each chunk
+	type container struct {
+		key  uint16
+		card int
+		base int // first word of the chunk
+	}
+	var buckets [][]container
+	var highs []uint32
+	for i, last := 0, s.lastWord(); i <= last; i += roaringChunkWords {
+		end := i + roaringChunkWords
+		if end > len(s.data) {
+			end = len(s.data)
+		}
+		var card int
+		for j := i; j < end; j++ {
+			card += bits.OnesCount64(s.word(j))
+		}
+		if card == 0 {
+			continue
+		}
+		chunk := uint64(i) / roaringChunkWords
+		high := uint32(chunk >> 16)
+		if len(highs) == 0 || highs[len(highs)-1] != high {
+			highs = append(highs, high)
+			buckets = append(buckets, nil)
+		}
+		b := len(buckets) - 1
+		buckets[b] = append(buckets[b], container{uint16(chunk), card, i})
+	}
+
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(len(buckets)))
+	for n, cs := range buckets {
+		buf = binary.LittleEndian.AppendUint32(buf, highs[n])
+		buf = binary.LittleEndian.AppendUint32(buf, roaringNoRunCookie)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(cs)))
+		for _, c := range cs {
+			buf = binary.LittleEndian.AppendUint16(buf, c.key)
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(c.card-1))
+		}
+		offset := 8 + 8*len(cs)
+		for _, c := range cs {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(offset))
+			if c.card <= roaringArrayMax {
+				offset += 2 * c.card
+			} else {
+				offset += 8 * roaringChunkWords
+			}
+		}
+		for _, c := range cs {
+			if c.card <= roaringArrayMax {
+				for j := c.base; j < c.base+roaringChunkWords && j < len(s.data); j++ {
+					for v := s.word(j); v != 0; v &= v - 1 {
+						low := (j-c.base)<<6 + bits.TrailingZeros64(v)
+						buf = binary.LittleEndian.AppendUint16(buf, uint16(low))
+					}
+				}
+				continue
+			}
+			for j := c.base; j < c.base+roaringChunkWords; j++ {
+				var v uint64
+				if j < len(s.data) {
+					v = s.word(j)
+				}
+				buf = binary.LittleEndian.AppendUint64(buf, v)
+			}
+		}
+	}
+	return buf
+}
+
+// NewFromRoaring64 returns an instantiated BitArray of length bits holding
+// the set of a Roaring64 portable serialized bitmap, values beyond length
+// fail with ErrIndexOutOfRange. Array, bitmap and run containers are read.
+func NewFromRoaring64(data []byte, length int, concurrent bool) (*BitArray, error) {
+	s := New(length, concurrent)
+	r := roaringReader{data: data}
+	buckets := r.uint64()
+	if r.err == nil && buckets > uint64(len(data))/12 {
+		return nil, fmt.Errorf("%w: bad bucket count", ErrCorruptData)
+	}
+	for b := uint64(0); b < buckets && r.err == nil; b++ {
+		high := uint64(r.uint32())
+		if err := s.readRoaring32(&r, high<<32); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.off != len(data) {
+		return nil, fmt.Errorf("%w: trailing data", ErrCorruptData)
+	}
+	if n := len(s.data); n > 0 && s.data[n-1]&^tailMask(length) != 0 {
+		return nil, &RangeError{Index: s.lastIndex(), Length: length}
+	}
+	for i := len(s.data) - 1; i > 0; i-- {
+		if s.data[i] != 0 {
+			s.right = int64(i)
+			break
+		}
+	}
+	return s, nil
+}
+
+// lastIndex returns index of the last set bit of data words, or -1
+func (s *BitArray) lastIndex() int {
+	for i := len(s.data) - 1; i >= 0; i-- {
+		if v := s.data[i]; v != 0 {
+			return i<<6 + 63 - bits.LeadingZeros64(v)
+		}
+	}
+	return -1
+}
+
+// readRoaring32 sets bits of a 32-bit Roaring bitmap with values
+// starting at base, BitArray must not be shared yet
+func (s *BitArray) readRoaring32(r *roaringReader, base uint64) error {
+	cookie := r.uint32()
+	var size int
+	var runs []byte
+	switch {
+	case cookie&0xffff == roaringRunCookie:
+		size = int(cookie>>16) + 1
+		runs = r.bytes((size + 7) / 8)
+	case cookie == roaringNoRunCookie:
+		n := r.uint32()
+		if n > 1<<16 {
+			return fmt.Errorf("%w: bad container count", ErrCorruptData)
+		}
+		size = int(n)
+	default:
+		if r.err != nil {
+			return r.err
+		}
+		return fmt.Errorf("%w: bad roaring cookie", ErrCorruptData)
+	}
+	desc := r.bytes(4 * size)
+	if runs == nil || size >= roaringNoOffsetRuns {
+		r.bytes(4 * size)
+	}
+	if r.err != nil {
+		return r.err
+	}
+	for c := 0; c < size; c++ {
+		key := uint64(binary.LittleEndian.Uint16(desc[4*c:]))
+		card := int(binary.LittleEndian.Uint16(desc[4*c+2:])) + 1
+		from := base | key<<16
+		switch {
+		case runs != nil && runs[c/8]&(1<<(c%8)) != 0:
+			n := int(r.uint16())
+			for i := 0; i < n && r.err == nil; i++ {
+				start := uint64(r.uint16())
+				end := start + uint64(r.uint16()) + 1
+				if end > 1<<16 {
+					return fmt.Errorf("%w: bad run", ErrCorruptData)
+				}
+				if err := s.fillRoaring(from+start, from+end); err != nil {
+					return err
+				}
+			}
+		case card > roaringArrayMax:
+			words := r.bytes(8 * roaringChunkWords)
+			for i := 0; i < roaringChunkWords && r.err == nil; i++ {
+				v := binary.LittleEndian.Uint64(words[8*i:])
+				if v == 0 {
+					continue
+				}
+				w := from/64 + uint64(i)
+				if w >= uint64(len(s.data)) {
+					return roaringRangeError(w*64+uint64(bits.TrailingZeros64(v)), s.Len())
+				}
+				s.data[w] |= v
+			}
+		default:
+			vals := r.bytes(2 * card)
+			for i := 0; i < card && r.err == nil; i++ {
+				if err := s.fillRoaring(from+uint64(binary.LittleEndian.Uint16(vals[2*i:])), 0); err != nil {
+					return err
+				}
+			}
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// fillRoaring sets bits [from, to) or the single bit from when to is 0
+func (s *BitArray) fillRoaring(from, to uint64) error {
+	if to == 0 {
+		to = from + 1
+	}
+	if to > uint64(s.Len()) {
+		return roaringRangeError(to-1, s.Len())
+	}
+	for i := from; i < to; i++ {
+		s.data[i>>6] |= 1 << (i & 0x3f)
+	}
+	return nil
+}
+
+func roaringRangeError(index uint64, length int) error {
+	if index > uint64(maxInt) {
+		index = uint64(maxInt)
+	}
+	return &RangeError{Index: int(index), Length: length}
+}
+
+// roaringReader reads little endian values, remembering truncation
+type roaringReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *roaringReader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data)-r.off {
+		if r.err == nil {
+			r.err = fmt.Errorf("%w: truncated", ErrCorruptData)
+		}
+		return make([]byte, n)
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *roaringReader) uint16() uint16 {
+	return binary.LittleEndian.Uint16(r.bytes(2))
+}
+
+func (r *roaringReader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(4))
+}
+
+func (r *roaringReader) uint64() uint64 {
+	return binary.LittleEndian.Uint64(r.bytes(8))
+}
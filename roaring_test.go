@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestRoaring64(t *testing.T) {
+	s := New(300000, true)
+	// an array container, a bitmap container and an empty one
+	s.Set(1)
+	s.Set(65535)
+	for i := 65536 * 2; i < 65536*2+5000; i++ {
+		s.Set(i)
+	}
+	s.Set(299999)
+	data := s.MarshalRoaring64()
+	// bucket count, high bits, cookie, container count
+	if binary.LittleEndian.Uint64(data) != 1 || binary.LittleEndian.Uint32(data[8:]) != 0 ||
+		binary.LittleEndian.Uint32(data[12:]) != 12346 || binary.LittleEndian.Uint32(data[16:]) != 3 {
+		t.Fatalf("failed on test case 1")
+	}
+	if len(data) != 8+4+8+3*8+2*2+8192+2 {
+		t.Fatalf("failed on test case 2")
+	}
+	res, err := NewFromRoaring64(data, 300000, false)
+	if err != nil || res.DiffCount(s) != 0 || res.Count() != 5003 {
+		t.Fatalf("failed on test case 3")
+	}
+	if _, err = NewFromRoaring64(data, 299999, false); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("failed on test case 4")
+	}
+	if _, err = NewFromRoaring64(data[:len(data)-1], 300000, false); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 5")
+	}
+	if empty := New(100, false).MarshalRoaring64(); len(empty) != 8 {
+		t.Fatalf("failed on test case 6")
+	}
+
+	// a run container [10, 20] and an array container in bucket 0,
+	// written with the run cookie and no offset header
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint64(buf, 1)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, 12347|1<<16)
+	buf = append(buf, 0x01)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, 10)
+	buf = binary.LittleEndian.AppendUint16(buf, 1)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, 1)
+	buf = binary.LittleEndian.AppendUint16(buf, 10)
+	buf = binary.LittleEndian.AppendUint16(buf, 10)
+	buf = binary.LittleEndian.AppendUint16(buf, 7)
+	res, err = NewFromRoaring64(buf, 1<<17, false)
+	if err != nil || res.Count() != 12 || !res.Get(10) || !res.Get(20) || res.Get(21) || !res.Get(65543) {
+		t.Fatalf("failed on test case 7")
+	}
+	// a second bucket is beyond the length
+	buf = binary.LittleEndian.AppendUint64(nil, 1)
+	buf = binary.LittleEndian.AppendUint32(buf, 1)
+	buf = append(buf, data[12:]...)
+	if _, err = NewFromRoaring64(buf, 300000, false); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("failed on test case 8")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+// Runs returns maximal ranges of consecutive set bits in ascending order
+func (s *BitArray) Runs() []Range {
+	var res []Range
+	s.forEachRun(func(from, to int) bool {
+		res = append(res, Range{from, to})
+		return true
+	})
+	return res
+}
+
+// forEachRun calls fn for maximal runs of set bits [from, to) in ascending
+// order until it returns false, whole words are skipped at once
+func (s *BitArray) forEachRun(fn func(from, to int) bool) {
+	for from := s.nextSet(0); from >= 0; {
+		to := s.nextClear(from)
+		if to < 0 {
+			to = s.Len()
+		}
+		if !fn(from, to) {
+			return
+		}
+		from = s.nextSet(to)
+	}
+}
+
+// LongestRunOfOnes returns start and length of the first longest run of
+// set bits, length is 0 when no bit is set
+func (s *BitArray) LongestRunOfOnes() (start, length int) {
+	s.forEachRun(func(from, to int) bool {
+		if to-from > length {
+			start, length = from, to-from
+		}
+		return true
+	})
+	return start, length
+}
+
+// LongestRunOfZeros returns start and length of the first longest run of
+// clear bits within length, length is 0 when all bits are set
+func (s *BitArray) LongestRunOfZeros() (start, length int) {
+	for from := s.nextClear(0); from >= 0; {
+		to := s.nextSet(from)
+		if to < 0 {
+			to = s.Len()
+		}
+		if to-from > length {
+			start, length = from, to-from
+		}
+		from = s.nextClear(to)
+	}
+	return start, length
+}
+
+// FindClearRun returns start of the first run of at least n clear bits
+// within length, ok is false when there is none
+func (s *BitArray) FindClearRun(n int) (int, bool) {
+	i := s.findClearRun(0, n)
+	return i, i >= 0
+}
+
+// findClearRun returns start of the first run of at least n clear bits at
+// or after from, or -1. Full words are skipped at once.
+func (s *BitArray) findClearRun(from, n int) int {
+	if n < 1 {
+		n = 1
+	}
+	for from = s.nextClear(from); from >= 0; from = s.nextClear(from) {
+		to := s.nextSet(from)
+		if to < 0 {
+			to = s.Len()
+		}
+		if to-from >= n {
+			return from
+		}
+		if to >= s.Len() {
+			break
+		}
+		from = to
+	}
+	return -1
+}
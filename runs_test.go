@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestBitArrayLongestRun(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		if start, n := ba.LongestRunOfOnes(); start != 0 || n != 0 {
+			t.Fatalf("failed on test case 1")
+		}
+		if start, n := ba.LongestRunOfZeros(); start != 0 || n != 1000 {
+			t.Fatalf("failed on test case 2")
+		}
+		ba.SetRange(10, 20)
+		ba.SetRange(60, 200)
+		ba.SetRange(300, 440)
+		ba.SetRange(900, 1000)
+		if start, n := ba.LongestRunOfOnes(); start != 60 || n != 140 {
+			t.Fatalf("failed on test case 3")
+		}
+		if start, n := ba.LongestRunOfZeros(); start != 440 || n != 460 {
+			t.Fatalf("failed on test case 4")
+		}
+		ba.SetAll()
+		if start, n := ba.LongestRunOfOnes(); start != 0 || n != 1000 {
+			t.Fatalf("failed on test case 5")
+		}
+		if _, n := ba.LongestRunOfZeros(); n != 0 {
+			t.Fatalf("failed on test case 6")
+		}
+	}
+}
+
+func TestBitArrayRuns(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		if len(ba.Runs()) != 0 {
+			t.Fatalf("failed on test case 1")
+		}
+		want := []Range{{0, 1}, {10, 20}, {63, 129}, {500, 501}, {900, 1000}}
+		for _, r := range want {
+			ba.SetRange(r.Start, r.End)
+		}
+		got := ba.Runs()
+		if len(got) != len(want) {
+			t.Fatalf("failed on test case 2")
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("failed on test case 3")
+			}
+		}
+	}
+}
+
+func TestBitArrayFindClearRun(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(1000, concurrent)
+		ba.SetRange(0, 100)
+		ba.SetRange(105, 300)
+		ba.SetRange(350, 1000)
+		if i, ok := ba.FindClearRun(3); !ok || i != 100 {
+			t.Fatalf("failed on test case 1")
+		}
+		if i, ok := ba.FindClearRun(6); !ok || i != 300 {
+			t.Fatalf("failed on test case 2")
+		}
+		if i, ok := ba.FindClearRun(50); !ok || i != 300 {
+			t.Fatalf("failed on test case 3")
+		}
+		if _, ok := ba.FindClearRun(51); ok {
+			t.Fatalf("failed on test case 4")
+		}
+		ba.SetRange(300, 350)
+		ba.RemoveRange(990, 1000)
+		if i, ok := ba.FindClearRun(10); !ok || i != 990 {
+			t.Fatalf("failed on test case 5")
+		}
+		if i, ok := ba.FindClearRun(0); !ok || i != 100 {
+			t.Fatalf("failed on test case 6")
+		}
+	}
+}
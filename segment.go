@@ -0,0 +1,324 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	kindSegment = 4
+	segmentV1   = 1
+
+	segmentPrefix = "segment-"
+	segmentSuffix = ".goba"
+	segmentBase   = 1 // flag of segments holding the whole state
+)
+
+// SegmentOptions configures automatic flushes and compactions of
+// SegmentStore, zero values leave them to explicit calls
+type SegmentOptions struct {
+	// FlushEvery flushes the memory segment after this many mutations
+	FlushEvery int
+	// CompactAfter compacts once this many segments are written
+	// since the last compaction
+	CompactAfter int
+}
+
+// SegmentStore persists an append-heavy BitArray as a log of segments.
+//
+// Mutations go to an in-memory segment of set and cleared bits, Flush
+// writes it as an immutable compressed segment file and Compact merges all
+// segment files into a single one holding the whole state. Writes cost a
+// segment of changes instead of a rewrite of the whole array. Queries are
+// served from memory. It is safe for concurrent usage.
+type SegmentStore struct {
+	mu       sync.RWMutex
+	dir      string
+	length   int
+	opts     SegmentOptions
+	view     *BitArray // state of flushed segments
+	set      *BitArray // bits set since the last flush
+	cleared  *BitArray // bits cleared since the last flush
+	pending  int       // mutations since the last flush
+	seq      uint64    // sequence number of the last segment file
+	segments int       // segment files since the last compaction
+}
+
+// OpenSegmentStore opens the store of length bits in dir, loading segment
+// files written before, and creates dir when missing
+func OpenSegmentStore(dir string, length int, opts SegmentOptions) (*SegmentStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	st := &SegmentStore{
+		dir:     dir,
+		length:  length,
+		opts:    opts,
+		view:    New(length, false),
+		set:     New(length, false),
+		cleared: New(length, false),
+	}
+	seqs, err := st.segmentFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		set, cleared, flags, err := st.readSegment(seq)
+		if err != nil {
+			return nil, err
+		}
+		if flags&segmentBase != 0 {
+			st.view.RemoveAll()
+			st.segments = 0
+		}
+		st.view.applySegment(set, cleared)
+		st.seq = seq
+		st.segments++
+	}
+	return st, nil
+}
+
+// Set sets bit at index, the error comes from an automatic flush
+func (st *SegmentStore) Set(index int) error {
+	return st.mutate(index, true)
+}
+
+// Remove removes bit at index, the error comes from an automatic flush
+func (st *SegmentStore) Remove(index int) error {
+	return st.mutate(index, false)
+}
+
+func (st *SegmentStore) mutate(index int, value bool) error {
+	if index < 0 || index >= st.length {
+		return &RangeError{Index: index, Length: st.length}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if value {
+		st.set.Set(index)
+		st.cleared.Remove(index)
+	} else {
+		st.set.Remove(index)
+		st.cleared.Set(index)
+	}
+	st.pending++
+	if st.opts.FlushEvery > 0 && st.pending >= st.opts.FlushEvery {
+		return st.flush()
+	}
+	return nil
+}
+
+// Get returns bit at index of the merged view
+func (st *SegmentStore) Get(index int) bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	switch {
+	case st.set.Get(index):
+		return true
+	case st.cleared.Get(index):
+		return false
+	}
+	return st.view.Get(index)
+}
+
+// View returns a copy of the merged view
+func (st *SegmentStore) View() *BitArray {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	res := st.view.Clone()
+	res.applySegment(st.set, st.cleared)
+	return res
+}
+
+// Count returns count of set bits of the merged view
+func (st *SegmentStore) Count() int {
+	return st.View().Count()
+}
+
+// Flush writes mutations since the last flush as a segment file
+func (st *SegmentStore) Flush() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.flush()
+}
+
+func (st *SegmentStore) flush() error {
+	if st.pending == 0 {
+		return nil
+	}
+	if err := st.writeSegment(st.seq+1, st.set, st.cleared, 0); err != nil {
+		return err
+	}
+	st.seq++
+	st.segments++
+	st.view.applySegment(st.set, st.cleared)
+	st.set.RemoveAll()
+	st.cleared.RemoveAll()
+	st.pending = 0
+	if st.opts.CompactAfter > 0 && st.segments >= st.opts.CompactAfter {
+		return st.compact()
+	}
+	return nil
+}
+
+// Compact flushes and merges all segment files into a single one
+func (st *SegmentStore) Compact() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.flush(); err != nil {
+		return err
+	}
+	return st.compact()
+}
+
+func (st *SegmentStore) compact() error {
+	old, err := st.segmentFiles()
+	if err != nil {
+		return err
+	}
+	if len(old) <= 1 {
+		return nil
+	}
+	// the base segment overrides older ones, which makes removing them
+	// safe to interrupt
+	if err = st.writeSegment(st.seq+1, st.view, New(st.length, false), segmentBase); err != nil {
+		return err
+	}
+	st.seq++
+	st.segments = 1
+	for _, seq := range old {
+		if err = os.Remove(st.segmentPath(seq)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes pending mutations
+func (st *SegmentStore) Close() error {
+	return st.Flush()
+}
+
+// applySegment clears bits of cleared and sets bits of set
+func (s *BitArray) applySegment(set, cleared *BitArray) {
+	s.combineFrom(cleared, func(a, b uint64) uint64 { return a &^ b })
+	s.combineFrom(set, func(a, b uint64) uint64 { return a | b })
+}
+
+func (st *SegmentStore) segmentPath(seq uint64) string {
+	return filepath.Join(st.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+// segmentFiles returns ascending sequence numbers of segment files
+func (st *SegmentStore) segmentFiles() ([]uint64, error) {
+	entries, err := os.ReadDir(st.dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err == nil {
+			res = append(res, seq)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res, nil
+}
+
+// writeSegment writes a segment file of header, flags and a deflated
+// stream of length and the words of set and cleared bits
+func (st *SegmentStore) writeSegment(seq uint64, set, cleared *BitArray, flags uint8) error {
+	path := st.segmentPath(seq)
+	f, err := os.CreateTemp(st.dir, ".segment-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	w.Write(append(appendHeader(nil, segmentV1, kindSegment), flags))
+	zw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(st.length))
+	zw.Write(buf[:])
+	for _, ba := range []*BitArray{set, cleared} {
+		for i := range ba.data {
+			binary.LittleEndian.PutUint64(buf[:], ba.word(i))
+			zw.Write(buf[:])
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (st *SegmentStore) readSegment(seq uint64) (set, cleared *BitArray, flags uint8, err error) {
+	f, err := os.Open(st.segmentPath(seq))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if _, err = readHeader(r, kindSegment, segmentV1); err != nil {
+		return nil, nil, 0, err
+	}
+	if flags, err = r.ReadByte(); err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: truncated", ErrCorruptData)
+	}
+	zr := flate.NewReader(r)
+	defer zr.Close()
+	var buf [8]byte
+	if err = readFull(zr, buf[:]); err != nil {
+		return nil, nil, 0, err
+	}
+	if binary.LittleEndian.Uint64(buf[:]) != uint64(st.length) {
+		return nil, nil, 0, ErrLengthMismatch
+	}
+	set, cleared = New(st.length, false), New(st.length, false)
+	for _, ba := range []*BitArray{set, cleared} {
+		raw := make([]byte, 8*len(ba.data))
+		if err = readFull(zr, raw); err != nil {
+			return nil, nil, 0, err
+		}
+		for i := range ba.data {
+			ba.data[i] = binary.LittleEndian.Uint64(raw[8*i:])
+		}
+		if n := len(ba.data); n > 0 && ba.data[n-1]&^tailMask(st.length) != 0 {
+			return nil, nil, 0, fmt.Errorf("%w: bits beyond length", ErrCorruptData)
+		}
+		ba.right = int64(len(ba.data)) - 1
+		if ba.right < 0 {
+			ba.right = 0
+		}
+	}
+	if _, err = zr.Read(buf[:1]); err != io.EOF {
+		return nil, nil, 0, fmt.Errorf("%w: trailing data", ErrCorruptData)
+	}
+	return set, cleared, flags, nil
+}
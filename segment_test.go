@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSegmentStore(t *testing.T) {
+	dir := t.TempDir()
+	st, err := OpenSegmentStore(dir, 1000, SegmentOptions{FlushEvery: 3})
+	if err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	for _, i := range []int{1, 2, 3, 500, 999} {
+		if err = st.Set(i); err != nil {
+			t.Fatalf("failed on test case 2: %v", err)
+		}
+	}
+	st.Remove(2)
+	if !st.Get(1) || st.Get(2) || !st.Get(999) || st.Count() != 4 {
+		t.Fatalf("failed on test case 3")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "segment-*")); len(files) != 2 {
+		t.Fatalf("failed on test case 4")
+	}
+	if err = st.Close(); err != nil {
+		t.Fatalf("failed on test case 5: %v", err)
+	}
+
+	st, err = OpenSegmentStore(dir, 1000, SegmentOptions{})
+	if err != nil || st.Count() != 4 || st.Get(2) || !st.Get(500) {
+		t.Fatalf("failed on test case 6")
+	}
+	st.Remove(500)
+	if err = st.Compact(); err != nil {
+		t.Fatalf("failed on test case 7: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "segment-*")); len(files) != 1 {
+		t.Fatalf("failed on test case 8")
+	}
+	st, err = OpenSegmentStore(dir, 1000, SegmentOptions{})
+	if err != nil || st.Count() != 3 || st.Get(500) || !st.View().Get(3) {
+		t.Fatalf("failed on test case 9")
+	}
+	if _, err = OpenSegmentStore(dir, 999, SegmentOptions{}); !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("failed on test case 10")
+	}
+	if err = st.Set(1000); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("failed on test case 11")
+	}
+
+	// a base segment overrides older ones left by an interrupted compaction
+	st.Set(7)
+	st.Flush()
+	files, _ := filepath.Glob(filepath.Join(dir, "segment-*"))
+	old, _ := os.ReadFile(files[0])
+	st.Compact()
+	os.WriteFile(filepath.Join(dir, "segment-00000000000000000001.goba"), old, 0o644)
+	st, err = OpenSegmentStore(dir, 1000, SegmentOptions{})
+	if err != nil || st.Count() != 4 || st.Get(500) {
+		t.Fatalf("failed on test case 12")
+	}
+}
+
+func TestSegmentStoreCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "segment-00000000000000000001.goba"), []byte("GOBA\x01\x04\x00\x00"), 0o644)
+	if _, err := OpenSegmentStore(dir, 1000, SegmentOptions{}); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 1")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"iter"
+	"math/bits"
+)
+
+// Ones returns an iterator over indices of set bits in ascending order,
+// zero words are skipped. Words are read as the iteration reaches them.
+func (s *BitArray) Ones() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := 0; i <= s.lastWord(); i++ {
+			for v := s.word(i); v != 0; v &= v - 1 {
+				if !yield(i<<6 + bits.TrailingZeros64(v)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Zeros returns an iterator over indices of clear bits within length in
+// ascending order, full words are skipped
+func (s *BitArray) Zeros() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		n := len(s.data)
+		for i := 0; i < n; i++ {
+			v := ^s.word(i)
+			if i == n-1 {
+				v &= tailMask(s.Len())
+			}
+			for ; v != 0; v &= v - 1 {
+				if !yield(i<<6 + bits.TrailingZeros64(v)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ForEachSet calls fn for indices of set bits in ascending order until it
+// returns false
+func (s *BitArray) ForEachSet(fn func(index int) bool) {
+	for i := range s.Ones() {
+		if !fn(i) {
+			return
+		}
+	}
+}
+
+// Words returns an iterator over indices and values of data words, bits
+// past length are zero. In concurrent mode each word is loaded atomically
+// when reached, so the words do not form a snapshot of one instant.
+func (s *BitArray) Words() iter.Seq2[int, uint64] {
+	return func(yield func(int, uint64) bool) {
+		for i := 0; i < len(s.data); i++ {
+			if !yield(i, s.word(i)) {
+				return
+			}
+		}
+	}
+}
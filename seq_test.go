@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestBitArrayOnesZeros(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(130, concurrent)
+		want := []int{0, 63, 64, 129}
+		for _, i := range want {
+			ba.Set(i)
+		}
+		var got []int
+		for i := range ba.Ones() {
+			got = append(got, i)
+		}
+		if len(got) != len(want) || got[1] != 63 || got[3] != 129 {
+			t.Fatalf("failed on test case 1")
+		}
+		var zeros int
+		for i := range ba.Zeros() {
+			if ba.Get(i) || i >= 130 {
+				t.Fatalf("failed on test case 2")
+			}
+			zeros++
+		}
+		if zeros != 126 {
+			t.Fatalf("failed on test case 3")
+		}
+		var n int
+		for i := range ba.Ones() {
+			if i > 63 {
+				break
+			}
+			n++
+		}
+		for range ba.Zeros() {
+			break
+		}
+		if n != 2 {
+			t.Fatalf("failed on test case 4")
+		}
+	}
+}
+
+func TestBitArrayForEachSet(t *testing.T) {
+	ba := New(1000, true)
+	for i := 0; i < 1000; i += 10 {
+		ba.Set(i)
+	}
+	var got []int
+	ba.ForEachSet(func(i int) bool {
+		got = append(got, i)
+		return len(got) < 3
+	})
+	if len(got) != 3 || got[0] != 0 || got[2] != 20 {
+		t.Fatalf("failed on test case 1")
+	}
+	var n int
+	ba.ForEachSet(func(int) bool {
+		n++
+		return true
+	})
+	if n != 100 {
+		t.Fatalf("failed on test case 2")
+	}
+}
+
+func TestBitArrayWords(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		ba := New(200, concurrent)
+		ba.Set(1)
+		ba.Set(64)
+		ba.Set(199)
+		var cnt, n int
+		for i, w := range ba.Words() {
+			if i != n {
+				t.Fatalf("failed on test case 1")
+			}
+			if i == 1 && w != 1 {
+				t.Fatalf("failed on test case 2")
+			}
+			n++
+			for ; w != 0; w &= w - 1 {
+				cnt++
+			}
+		}
+		if n != 4 || cnt != 3 {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+}
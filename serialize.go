@@ -0,0 +1,388 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Serialized data of every kind starts with a header of magic,
+// format version, kind and two reserved bytes
+const (
+	formatMagic   = "GOBA"
+	headerSize    = 8
+	kindBitArray  = 1
+	bitArrayV1    = 1
+	bitArrayV2    = 2    // header fields and chunks end with a CRC-32C
+	snapshotChunk = 8192 // words per chunk of Snapshot
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func appendHeader(buf []byte, version, kind uint8) []byte {
+	buf = append(buf, formatMagic...)
+	return append(buf, version, kind, 0, 0)
+}
+
+// readHeader reads a header of kind and returns its format version,
+// which is at most maxVersion
+func readHeader(r io.Reader, kind, maxVersion uint8) (uint8, error) {
+	var buf [headerSize]byte
+	if err := readFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	if string(buf[:4]) != formatMagic || buf[5] != kind {
+		return 0, fmt.Errorf("%w: bad header", ErrCorruptData)
+	}
+	if buf[4] == 0 || buf[4] > maxVersion {
+		return 0, fmt.Errorf("%w: %d", ErrFormatVersion, buf[4])
+	}
+	return buf[4], nil
+}
+
+// readFull is io.ReadFull reporting truncated data as corrupt
+func readFull(r io.Reader, buf []byte) error {
+	_, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated", ErrCorruptData)
+	}
+	return err
+}
+
+// Snapshot returns a serialized copy of BitArray for state machines of
+// consensus protocols like Raft.
+//
+// Data is copied when Snapshot is called and streamed afterwards, so
+// writes may continue while the snapshot is persisted or sent. With
+// TrackConsistency a concurrent BitArray is copied at a single instant. The stream is made of chunks, the returned reader is also an
+// io.Seeker to resume an interrupted transfer at a byte offset.
+func (s *BitArray) Snapshot() (io.ReadCloser, error) {
+	words := make([]uint64, len(s.data))
+	s.consistent(func() {
+		for i := range words {
+			words[i] = s.word(i)
+		}
+	})
+	hdr := appendHeader(make([]byte, 0, headerSize+12), bitArrayV1, kindBitArray)
+	hdr = binary.LittleEndian.AppendUint64(hdr, uint64(s.Len()))
+	hdr = binary.LittleEndian.AppendUint32(hdr, snapshotChunk)
+	return &snapshotReader{header: hdr, words: words, chunk: -1}, nil
+}
+
+// ExportConsistent writes a snapshot of BitArray as of the call to w, in
+// the format of Snapshot, while concurrent writers proceed.
+//
+// Instead of copying all data upfront, blocks of words are copied when
+// written out or right before a writer changes them, like Iterator does,
+// so memory use stays low for multi-GB arrays.
+func (s *BitArray) ExportConsistent(w io.Writer) error {
+	return s.export(w, bitArrayV1)
+}
+
+// export writes a consistent snapshot in format version
+func (s *BitArray) export(w io.Writer, version uint8) error {
+	it := s.Iterate()
+	defer it.Close()
+	words := (it.length + 63) / 64
+	buf := appendHeader(make([]byte, 0, headerSize+16), version, kindBitArray)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(it.length))
+	buf = binary.LittleEndian.AppendUint32(buf, snapshotChunk)
+	if version >= bitArrayV2 {
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf[headerSize:], castagnoli))
+	}
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	for lo := 0; lo < words; lo += snapshotChunk {
+		hi := lo + snapshotChunk
+		if hi > words {
+			hi = words
+		}
+		buf = binary.LittleEndian.AppendUint64(buf[:0], uint64(lo))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(hi-lo))
+		// chunks are made of whole blocks
+		for b := lo / iterBlockWords; b*iterBlockWords < hi; b++ {
+			for _, v := range it.block(b) {
+				buf = binary.LittleEndian.AppendUint64(buf, v)
+			}
+			it.release(b)
+		}
+		if version >= bitArrayV2 {
+			buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotReader encodes chunks of words on demand
+type snapshotReader struct {
+	header []byte
+	words  []uint64
+	pos    int64
+	chunk  int    // index of the encoded chunk in buf
+	buf    []byte // encoded chunk
+}
+
+// size returns encoded size of chunk k
+func (r *snapshotReader) size(k int) int64 {
+	n := len(r.words) - k*snapshotChunk
+	if n > snapshotChunk {
+		n = snapshotChunk
+	}
+	return 12 + 8*int64(n)
+}
+
+func (r *snapshotReader) total() int64 {
+	chunks := (len(r.words) + snapshotChunk - 1) / snapshotChunk
+	total := int64(len(r.header))
+	if chunks > 0 {
+		total += int64(chunks-1)*r.size(0) + r.size(chunks-1)
+	}
+	return total
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	if r.words == nil && r.header == nil {
+		return 0, fmt.Errorf("%w: read of snapshot", ErrClosed)
+	}
+	var n int
+	for len(p) > 0 {
+		if r.pos < int64(len(r.header)) {
+			c := copy(p, r.header[r.pos:])
+			n, p, r.pos = n+c, p[c:], r.pos+int64(c)
+			continue
+		}
+		full := r.size(0)
+		k := int((r.pos - int64(len(r.header))) / full)
+		if k*snapshotChunk >= len(r.words) {
+			break
+		}
+		if k != r.chunk {
+			r.encode(k)
+		}
+		off := (r.pos - int64(len(r.header))) % full
+		if off >= int64(len(r.buf)) {
+			break
+		}
+		c := copy(p, r.buf[off:])
+		n, p, r.pos = n+c, p[c:], r.pos+int64(c)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// encode chunk k into buf, prefixed by its word offset and count
+func (r *snapshotReader) encode(k int) {
+	words := r.words[k*snapshotChunk:]
+	if len(words) > snapshotChunk {
+		words = words[:snapshotChunk]
+	}
+	buf := binary.LittleEndian.AppendUint64(r.buf[:0], uint64(k*snapshotChunk))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(words)))
+	for _, v := range words {
+		buf = binary.LittleEndian.AppendUint64(buf, v)
+	}
+	r.buf, r.chunk = buf, k
+}
+
+func (r *snapshotReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.total()
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("%w: negative snapshot position", ErrInvalidArgument)
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+func (r *snapshotReader) Close() error {
+	r.header, r.words, r.buf = nil, nil, nil
+	return nil
+}
+
+// Restore replaces content and length of BitArray with a snapshot read
+// from r. BitArray is left unchanged on errors.
+//
+// Not safe for concurrent usage
+func (s *BitArray) Restore(r io.Reader) error {
+	data, length, err := readBitArray(r, false)
+	if err != nil {
+		return err
+	}
+	s.replace(data, length)
+	return nil
+}
+
+// readBitArray reads serialized words and length of BitArray. Damaged
+// chunks of checksummed data fail with a CorruptionError, with salvage
+// they read as zero and the error comes along with the data.
+func readBitArray(r io.Reader, salvage bool) ([]uint64, int, error) {
+	version, err := readHeader(r, kindBitArray, bitArrayV2)
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf [16]byte
+	hdr := buf[:12]
+	if version >= bitArrayV2 {
+		hdr = buf[:16]
+	}
+	if err := readFull(r, hdr); err != nil {
+		return nil, 0, err
+	}
+	if version >= bitArrayV2 && crc32.Checksum(hdr[:12], castagnoli) != binary.LittleEndian.Uint32(hdr[12:]) {
+		return nil, 0, fmt.Errorf("%w: header checksum mismatch", ErrCorruptData)
+	}
+	length := binary.LittleEndian.Uint64(hdr[:8])
+	chunk := int(binary.LittleEndian.Uint32(hdr[8:]))
+	if length > uint64(maxInt-63) || chunk == 0 {
+		return nil, 0, fmt.Errorf("%w: bad length", ErrCorruptData)
+	}
+	// data grows as chunks arrive, a damaged length costs no allocation
+	n := int((length + 63) / 64)
+	if version >= bitArrayV2 {
+		if chunk > maxChunkWords {
+			return nil, 0, fmt.Errorf("%w: bad chunk size", ErrCorruptData)
+		}
+		return readChecksummed(r, n, int(length), chunk, salvage)
+	}
+	data := make([]uint64, 0, chunkWords(n, snapshotChunk))
+	var raw []byte
+	for len(data) < n {
+		if err := readFull(r, buf[:12]); err != nil {
+			return nil, 0, err
+		}
+		offset := binary.LittleEndian.Uint64(buf[:8])
+		count := int(binary.LittleEndian.Uint32(buf[8:]))
+		if offset != uint64(len(data)) || count == 0 || count > n-len(data) {
+			return nil, 0, fmt.Errorf("%w: bad chunk at word %d", ErrCorruptData, len(data))
+		}
+		for count > 0 {
+			c := chunkWords(count, snapshotChunk)
+			if cap(raw) < 8*c {
+				raw = make([]byte, 8*c)
+			}
+			if err := readFull(r, raw[:8*c]); err != nil {
+				return nil, 0, err
+			}
+			for i := 0; i < c; i++ {
+				data = append(data, binary.LittleEndian.Uint64(raw[8*i:]))
+			}
+			count -= c
+		}
+	}
+	if len(data) > 0 && data[len(data)-1]&^tailMask(int(length)) != 0 {
+		return nil, 0, fmt.Errorf("%w: bits beyond length", ErrCorruptData)
+	}
+	return data, int(length), nil
+}
+
+// maxChunkWords bounds chunks of checksummed data, written ones have
+// snapshotChunk words
+const maxChunkWords = 1 << 20
+
+// chunkWords returns n bounded by chunk
+func chunkWords(n, chunk int) int {
+	if n > chunk {
+		return chunk
+	}
+	return n
+}
+
+// readChecksummed reads n words in chunks of chunk words. Chunks are at
+// known positions, so a damaged chunk is skipped and the rest still read.
+func readChecksummed(r io.Reader, n, length, chunk int, salvage bool) ([]uint64, int, error) {
+	var damaged []Range
+	var raw []byte
+	data := make([]uint64, 0, chunkWords(n, chunk))
+	for next := 0; next < n; next += chunk {
+		count := chunkWords(n-next, chunk)
+		if cap(raw) < 16+8*count {
+			raw = make([]byte, 16+8*count)
+		}
+		raw = raw[:16+8*count]
+		if err := readFull(r, raw); err != nil {
+			if !errors.Is(err, ErrCorruptData) {
+				return nil, 0, err
+			}
+			damaged = appendDamaged(damaged, next*64, length)
+			break
+		}
+		body := raw[:len(raw)-4]
+		ok := crc32.Checksum(body, castagnoli) == binary.LittleEndian.Uint32(raw[len(body):]) &&
+			binary.LittleEndian.Uint64(body) == uint64(next) &&
+			binary.LittleEndian.Uint32(body[8:]) == uint32(count)
+		for i := 0; i < count; i++ {
+			var v uint64
+			if ok {
+				v = binary.LittleEndian.Uint64(body[12+8*i:])
+			}
+			data = append(data, v)
+		}
+		if ok && next+count == n && data[n-1]&^tailMask(length) != 0 {
+			clear(data[next:])
+			ok = false
+		}
+		if !ok {
+			end := (next + count) * 64
+			if end > length {
+				end = length
+			}
+			damaged = appendDamaged(damaged, next*64, end)
+		}
+	}
+	if len(damaged) == 0 {
+		return data, length, nil
+	}
+	err := &CorruptionError{Ranges: damaged}
+	if !salvage {
+		return nil, 0, err
+	}
+	// the truncated tail reads as zero
+	data = append(data, make([]uint64, n-len(data))...)
+	return data, length, err
+}
+
+// appendDamaged appends bits [start, end) to ranges, merging adjacent ones
+func appendDamaged(ranges []Range, start, end int) []Range {
+	if n := len(ranges); n > 0 && ranges[n-1].End == start {
+		ranges[n-1].End = end
+		return ranges
+	}
+	return append(ranges, Range{start, end})
+}
+
+// replace swaps data and length of BitArray
+func (s *BitArray) replace(data []uint64, length int) {
+	s.writing(0, int64(len(s.data))-1)
+	if s.mapped != nil {
+		unmap(s.mapped)
+		s.mapped = nil
+	}
+	s.data = data
+	s.length = int64(length)
+	s.left = 0
+	s.right = 0
+	for i := len(data) - 1; i > 0; i-- {
+		if data[i] != 0 {
+			s.right = int64(i)
+			break
+		}
+	}
+	if s.dirty != nil {
+		s.TrackDirty(int(s.dirtyWords))
+	}
+	s.wrote(0, int64(len(data))-1)
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestBitArraySnapshotRestore(t *testing.T) {
+	ba := New(snapshotChunk*64*2+100, true)
+	ba.Set(0)
+	ba.Set(snapshotChunk*64 + 5)
+	ba.Set(ba.Len() - 1)
+
+	rc, err := ba.Snapshot()
+	if err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	// writes after Snapshot are not part of it
+	ba.Set(1)
+	raw, _ := io.ReadAll(rc)
+	rc.Close()
+
+	res := New(10, false)
+	if err := res.Restore(bytes.NewReader(raw)); err != nil {
+		t.Fatalf("failed on test case 2: %v", err)
+	}
+	if res.Len() != ba.Len() || res.Count() != 3 || !res.Get(snapshotChunk*64+5) || res.Get(1) {
+		t.Fatalf("failed on test case 3")
+	}
+}
+
+func TestBitArraySnapshotResume(t *testing.T) {
+	ba := New(snapshotChunk*64*3, false)
+	for i := 0; i < ba.Len(); i += 1001 {
+		ba.Set(i)
+	}
+	rc, _ := ba.Snapshot()
+	defer rc.Close()
+	whole, _ := io.ReadAll(rc)
+
+	// resume an interrupted transfer in the middle of a chunk
+	seeker := rc.(io.Seeker)
+	if end, _ := seeker.Seek(0, io.SeekEnd); end != int64(len(whole)) {
+		t.Fatalf("failed on test case 1: %d", end)
+	}
+	seeker.Seek(0, io.SeekStart)
+	part := make([]byte, 70000)
+	io.ReadFull(rc, part)
+	seeker.Seek(int64(len(part)), io.SeekStart)
+	rest, _ := io.ReadAll(rc)
+	if !bytes.Equal(append(part, rest...), whole) {
+		t.Fatalf("failed on test case 2")
+	}
+
+	res := New(0, true)
+	if err := res.Restore(bytes.NewReader(whole)); err != nil || res.DiffCount(ba) != 0 {
+		t.Fatalf("failed on test case 3: %v", err)
+	}
+}
+
+func TestBitArrayRestoreErrors(t *testing.T) {
+	ba := New(100, false)
+	ba.Set(7)
+	rc, _ := ba.Snapshot()
+	raw, _ := io.ReadAll(rc)
+
+	res := New(10, false)
+	res.Set(3)
+	if err := res.Restore(bytes.NewReader(raw[:len(raw)-1])); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	bad := append([]byte(nil), raw...)
+	bad[4] = 99
+	if err := res.Restore(bytes.NewReader(bad)); !errors.Is(err, ErrFormatVersion) {
+		t.Fatalf("failed on test case 2: %v", err)
+	}
+	bad = append([]byte(nil), raw...)
+	bad[0] = 'X'
+	if err := res.Restore(bytes.NewReader(bad)); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 3: %v", err)
+	}
+	bad = append([]byte(nil), raw...)
+	bad[len(bad)-1] = 0xff
+	if err := res.Restore(bytes.NewReader(bad)); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 4: %v", err)
+	}
+	if res.Len() != 10 || !res.Get(3) {
+		t.Fatalf("failed on test case 5")
+	}
+
+	empty, _ := New(0, false).Snapshot()
+	if err := res.Restore(empty); err != nil || res.Len() != 0 {
+		t.Fatalf("failed on test case 6: %v", err)
+	}
+
+	// damaged lengths fail without allocating for them
+	for _, length := range []uint64{math.MaxInt64, math.MaxInt64 - 63, 1 << 60} {
+		bad = append([]byte(nil), raw...)
+		binary.LittleEndian.PutUint64(bad[headerSize:], length)
+		if err := res.Restore(bytes.NewReader(bad)); !errors.Is(err, ErrCorruptData) {
+			t.Fatalf("failed on test case 7: %v", err)
+		}
+		var v2 bytes.Buffer
+		ba.export(&v2, bitArrayV2)
+		bad = v2.Bytes()
+		binary.LittleEndian.PutUint64(bad[headerSize:], length)
+		binary.LittleEndian.PutUint32(bad[headerSize+12:], crc32.Checksum(bad[headerSize:headerSize+12], castagnoli))
+		if err := res.Restore(bytes.NewReader(bad)); !errors.Is(err, ErrCorruptData) {
+			t.Fatalf("failed on test case 8: %v", err)
+		}
+	}
+
+	rc, _ = ba.Snapshot()
+	if _, err := rc.(io.Seeker).Seek(-1, io.SeekStart); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("failed on test case 9: %v", err)
+	}
+	rc.Close()
+	if _, err := rc.Read(make([]byte, 8)); !errors.Is(err, ErrClosed) {
+		t.Fatalf("failed on test case 10: %v", err)
+	}
+}
+
+// writeHook calls fn before every write
+type writeHook struct {
+	bytes.Buffer
+	fn func()
+}
+
+func (w *writeHook) Write(p []byte) (int, error) {
+	w.fn()
+	return w.Buffer.Write(p)
+}
+
+func TestBitArrayExportConsistent(t *testing.T) {
+	s := New(3*snapshotChunk*64+100, true)
+	for i := 0; i < s.Len(); i += 7 {
+		s.Set(i)
+	}
+	want := s.Clone()
+	var writes int
+	w := &writeHook{fn: func() {
+		// writers change the whole array while chunks are written
+		writes++
+		if writes%2 == 0 {
+			s.RemoveAll()
+		} else {
+			s.SetAll()
+		}
+	}}
+	if err := s.ExportConsistent(w); err != nil || writes != 5 {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	res := New(0, false)
+	if err := res.Restore(&w.Buffer); err != nil {
+		t.Fatalf("failed on test case 2: %v", err)
+	}
+	if res.Len() != want.Len() || res.DiffCount(want) != 0 {
+		t.Fatalf("failed on test case 3")
+	}
+	if s.iters.Load() != nil {
+		t.Fatalf("failed on test case 4")
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package server
+
+import (
+	"bufio"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nikchis/goba"
+)
+
+const (
+	errSyntax  = "ERR syntax error"
+	errOffset  = "ERR bit offset is not an integer or out of range"
+	errBit     = "ERR bit is not an integer or out of range"
+	errInteger = "ERR value is not an integer or out of range"
+	errType    = "ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."
+)
+
+// exec runs a command and writes its reply
+func (s *Server) exec(w *bufio.Writer, args []string) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		writeError(w, "ERR unknown command '"+args[0]+"'")
+		return
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs > 0 && len(args) > cmd.maxArgs) {
+		writeError(w, "ERR wrong number of arguments for '"+strings.ToLower(name)+"' command")
+		return
+	}
+	cmd.fn(s, w, args)
+}
+
+type command struct {
+	minArgs int
+	maxArgs int // 0 for no limit
+	fn      func(s *Server, w *bufio.Writer, args []string)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":     {1, 2, (*Server).ping},
+		"COMMAND":  {1, 0, (*Server).command},
+		"DEL":      {2, 0, (*Server).del},
+		"EXISTS":   {2, 0, (*Server).exists},
+		"SETBIT":   {4, 4, (*Server).setbit},
+		"GETBIT":   {3, 3, (*Server).getbit},
+		"BITCOUNT": {2, 0, (*Server).bitcount},
+		"BITPOS":   {3, 5, (*Server).bitpos},
+		"BITOP":    {4, 0, (*Server).bitop},
+		"BITFIELD": {2, 0, (*Server).bitfield},
+	}
+}
+
+func (s *Server) ping(w *bufio.Writer, args []string) {
+	if len(args) == 1 {
+		writeSimple(w, "PONG")
+		return
+	}
+	w.WriteString("$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n")
+}
+
+// command answers the introspection of clients with no command docs
+func (s *Server) command(w *bufio.Writer, args []string) {
+	writeArrayLen(w, 0)
+}
+
+func (s *Server) del(w *bufio.Writer, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if s.reg.Delete(key) {
+			n++
+		}
+	}
+	writeInt(w, n)
+}
+
+func (s *Server) exists(w *bufio.Writer, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if s.reg.Get(key) != nil {
+			n++
+		}
+	}
+	writeInt(w, n)
+}
+
+func (s *Server) setbit(w *bufio.Writer, args []string) {
+	offset, err := strconv.Atoi(args[2])
+	if err != nil || offset < 0 || offset >= s.reg.Length() {
+		writeError(w, errOffset)
+		return
+	}
+	if args[3] != "0" && args[3] != "1" {
+		writeError(w, errBit)
+		return
+	}
+	ba := s.reg.GetOrCreate(args[1])
+	if offset >= ba.Len() {
+		writeError(w, errOffset)
+		return
+	}
+	var old bool
+	if args[3] == "1" {
+		old = !ba.SetChanged(offset)
+	} else {
+		old = ba.RemoveChanged(offset)
+	}
+	writeBool(w, old)
+}
+
+func (s *Server) getbit(w *bufio.Writer, args []string) {
+	offset, err := strconv.Atoi(args[2])
+	if err != nil || offset < 0 {
+		writeError(w, errOffset)
+		return
+	}
+	// missing keys and bits past the end read as 0
+	ba := s.reg.Get(args[1])
+	writeBool(w, ba != nil && ba.Get(offset))
+}
+
+func (s *Server) bitcount(w *bufio.Writer, args []string) {
+	if len(args) == 3 || len(args) > 5 ||
+		(len(args) == 5 && !strings.EqualFold(args[4], "BYTE")) {
+		writeError(w, errSyntax)
+		return
+	}
+	var start, end int
+	var err error
+	if len(args) > 2 {
+		if start, err = strconv.Atoi(args[2]); err == nil {
+			end, err = strconv.Atoi(args[3])
+		}
+		if err != nil {
+			writeError(w, errInteger)
+			return
+		}
+	}
+	ba := s.reg.Get(args[1])
+	switch {
+	case ba == nil:
+		writeInt(w, 0)
+	case len(args) > 2:
+		writeInt(w, int64(ba.CountBytes(start, end)))
+	default:
+		writeInt(w, int64(ba.Count()))
+	}
+}
+
+func (s *Server) bitpos(w *bufio.Writer, args []string) {
+	if args[2] != "0" && args[2] != "1" {
+		writeError(w, "ERR The bit argument must be 1 or 0.")
+		return
+	}
+	value := args[2] == "1"
+	var start, end int
+	var err error
+	if len(args) > 3 {
+		if start, err = strconv.Atoi(args[3]); err != nil {
+			writeError(w, errInteger)
+			return
+		}
+	}
+	if len(args) > 4 {
+		if end, err = strconv.Atoi(args[4]); err != nil {
+			writeError(w, errInteger)
+			return
+		}
+	}
+	ba := s.reg.Get(args[1])
+	if ba == nil {
+		ba = goba.New(0, false)
+	}
+	if len(args) > 4 {
+		writeInt(w, int64(ba.Pos(value, start, end)))
+	} else {
+		writeInt(w, int64(ba.PosFrom(value, start)))
+	}
+}
+
+func (s *Server) bitop(w *bufio.Writer, args []string) {
+	op, dest := strings.ToUpper(args[1]), args[2]
+	srcs := make([]*goba.BitArray, 0, len(args)-3)
+	for _, key := range args[3:] {
+		ba := s.reg.Get(key)
+		if ba == nil {
+			ba = goba.New(0, true)
+		}
+		srcs = append(srcs, ba)
+	}
+	// the result replaces dest as a whole, readers of the old one are unaffected
+	dst := goba.New(0, true)
+	var n int
+	switch op {
+	case "AND":
+		n = goba.BitOpAnd(dst, srcs...)
+	case "OR":
+		n = goba.BitOpOr(dst, srcs...)
+	case "XOR":
+		n = goba.BitOpXor(dst, srcs...)
+	case "NOT":
+		if len(srcs) != 1 {
+			writeError(w, "ERR BITOP NOT must be called with a single source key.")
+			return
+		}
+		n = goba.BitOpNot(dst, srcs[0])
+	default:
+		writeError(w, errSyntax)
+		return
+	}
+	if n == 0 {
+		s.reg.Delete(dest)
+	} else {
+		s.reg.Put(dest, dst)
+	}
+	writeInt(w, int64(n))
+}
+
+func (s *Server) bitfield(w *bufio.Writer, args []string) {
+	ba := s.reg.Get(args[1])
+	var f *goba.Fields
+	if ba != nil {
+		f = ba.Fields()
+	}
+	var ops []func(f *goba.Fields)
+	var writes bool
+	for i := 2; i < len(args); {
+		sub := strings.ToUpper(args[i])
+		switch {
+		case sub == "OVERFLOW" && i+1 < len(args):
+			var o goba.Overflow
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				o = goba.OverflowWrap
+			case "SAT":
+				o = goba.OverflowSat
+			case "FAIL":
+				o = goba.OverflowFail
+			default:
+				writeError(w, "ERR Invalid OVERFLOW type specified")
+				return
+			}
+			ops = append(ops, func(f *goba.Fields) { f.Overflow(o) })
+			i += 2
+		case sub == "GET" && i+2 < len(args):
+			t, offset, msg := parseField(args[i+1], args[i+2])
+			if msg != "" {
+				writeError(w, msg)
+				return
+			}
+			ops = append(ops, func(f *goba.Fields) { f.Get(t, offset) })
+			i += 3
+		case (sub == "SET" || sub == "INCRBY") && i+3 < len(args):
+			t, offset, msg := parseField(args[i+1], args[i+2])
+			if msg != "" {
+				writeError(w, msg)
+				return
+			}
+			v, err := strconv.ParseInt(args[i+3], 10, 64)
+			if err != nil {
+				writeError(w, errInteger)
+				return
+			}
+			if sub == "SET" {
+				ops = append(ops, func(f *goba.Fields) { f.Set(t, offset, v) })
+			} else {
+				ops = append(ops, func(f *goba.Fields) { f.IncrBy(t, offset, v) })
+			}
+			writes = true
+			i += 4
+		default:
+			writeError(w, errSyntax)
+			return
+		}
+	}
+	if f == nil {
+		if writes {
+			ba = s.reg.GetOrCreate(args[1])
+		} else {
+			// reads of a missing key see zeros
+			ba = goba.New(s.reg.Length(), false)
+		}
+		f = ba.Fields()
+	}
+	for _, op := range ops {
+		op(f)
+	}
+	res, err := f.Exec()
+	if err != nil {
+		writeError(w, errOffset)
+		return
+	}
+	writeArrayLen(w, len(res))
+	for _, r := range res {
+		if r.OK {
+			writeInt(w, r.Value)
+		} else {
+			writeNil(w)
+		}
+	}
+}
+
+// parseField parses a type like i8 or u16 and an offset like 100 or #2,
+// the latter multiplied by the type width, it returns an error reply
+func parseField(typ, offset string) (goba.FieldType, int, string) {
+	var t goba.FieldType
+	if len(typ) < 2 || (typ[0] != 'i' && typ[0] != 'u' && typ[0] != 'I' && typ[0] != 'U') {
+		return t, 0, errType
+	}
+	n, err := strconv.Atoi(typ[1:])
+	if err != nil {
+		return t, 0, errType
+	}
+	if typ[0] == 'i' || typ[0] == 'I' {
+		t = goba.Signed(n)
+		if n < 1 || n > 64 {
+			return t, 0, errType
+		}
+	} else {
+		t = goba.Unsigned(n)
+		if n < 1 || n > 63 {
+			return t, 0, errType
+		}
+	}
+	mul := 1
+	if strings.HasPrefix(offset, "#") {
+		mul, offset = n, offset[1:]
+	}
+	o, err := strconv.Atoi(offset)
+	if err != nil || o < 0 || o > math.MaxInt/mul {
+		return t, 0, errOffset
+	}
+	return t, o * mul, ""
+}
+
+func writeBool(w *bufio.Writer, v bool) {
+	if v {
+		writeInt(w, 1)
+	} else {
+		writeInt(w, 0)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+
+// Package server serves goba Registry bitmaps over the Redis protocol,
+// so Redis clients can use SETBIT, GETBIT, BITCOUNT, BITPOS, BITOP and
+// BITFIELD against an in-process goba server.
+//
+// Bitmaps are created with the length of the Registry and do not grow,
+// writes beyond it fail like out of range offsets in Redis.
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nikchis/goba"
+)
+
+// Server answers Redis bitmap commands on Registry bitmaps
+type Server struct {
+	reg *goba.Registry
+
+	mu     sync.Mutex
+	ln     []net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// New returns a Server backed by reg
+func New(reg *goba.Registry) *Server {
+	return &Server{
+		reg:   reg,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("goba/server: server closed")
+
+// ListenAndServe listens on the TCP address addr and calls Serve
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln and serves each of them in a goroutine
+// until Close, it always returns a non-nil error
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.ln = append(s.ln, ln)
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// Close stops listeners and closes open connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, ln := range s.ln {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// ServeConn serves commands of a single connection until it is closed
+func (s *Server) ServeConn(conn net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				writeError(w, "ERR Protocol error")
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := strings.EqualFold(args[0], "QUIT")
+		if quit {
+			writeSimple(w, "OK")
+		} else {
+			s.exec(w, args)
+		}
+		// flush once all pipelined commands are answered
+		if r.Buffered() == 0 || quit {
+			if w.Flush() != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+var errProtocol = errors.New("protocol error")
+
+// Limits of requests, arguments are keys and integers so they are far
+// below the ones of Redis
+const (
+	maxArgs     = 1024 * 1024 // arguments of a command
+	maxBulkLen  = 1024 * 1024 // bytes of an argument
+	maxLineLen  = 64 * 1024   // bytes of an inline command or a header
+	bulkReadLen = 64 * 1024   // bytes of an argument read at once
+)
+
+// readCommand reads a RESP array of bulk strings or an inline command
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, errProtocol
+	}
+	if n < 0 {
+		// a null array, no command like in Redis
+		return nil, nil
+	}
+	var args []string
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, errProtocol
+		}
+		// memory grows with the payload received, not the size announced
+		buf.Reset()
+		for buf.Len() < size+2 {
+			c := size + 2 - buf.Len()
+			if c > bulkReadLen {
+				c = bulkReadLen
+			}
+			if _, err = io.CopyN(&buf, r, int64(c)); err != nil {
+				return nil, err
+			}
+		}
+		arg := buf.Bytes()
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, string(arg[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line of at most maxLineLen bytes
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, err := r.ReadSlice('\n')
+		if len(line)+len(part) > maxLineLen {
+			return "", errProtocol
+		}
+		line = append(line, part...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func writeSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func writeError(w *bufio.Writer, s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func writeInt(w *bufio.Writer, v int64) {
+	w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+}
+
+func writeNil(w *bufio.Writer) {
+	w.WriteString("$-1\r\n")
+}
+
+func writeArrayLen(w *bufio.Writer, n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
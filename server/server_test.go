@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nikchis/goba"
+)
+
+// roundTrip sends commands as RESP arrays and returns raw replies
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, cmds ...[]string) []string {
+	var b strings.Builder
+	for _, cmd := range cmds {
+		b.WriteString("*" + strconv.Itoa(len(cmd)) + "\r\n")
+		for _, arg := range cmd {
+			b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+		}
+	}
+	go conn.Write([]byte(b.String()))
+	var res []string
+	for range cmds {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed on reading reply: %v", err)
+		}
+		reply := strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(reply, "*") {
+			n, _ := strconv.Atoi(reply[1:])
+			for i := 0; i < n; i++ {
+				line, _ = r.ReadString('\n')
+				reply += " " + strings.TrimRight(line, "\r\n")
+			}
+		}
+		res = append(res, reply)
+	}
+	return res
+}
+
+func TestServer(t *testing.T) {
+	reg := goba.NewRegistry(1024)
+	srv := New(reg)
+	client, conn := net.Pipe()
+	go srv.ServeConn(conn)
+	defer srv.Close()
+	r := bufio.NewReader(client)
+
+	got := roundTrip(t, client, r,
+		[]string{"PING"},
+		[]string{"SETBIT", "a", "7", "1"},
+		[]string{"SETBIT", "a", "7", "1"},
+		[]string{"SETBIT", "a", "1024", "1"},
+		[]string{"GETBIT", "a", "7"},
+		[]string{"GETBIT", "missing", "7"},
+		[]string{"BITCOUNT", "a"},
+		[]string{"BITPOS", "a", "1"},
+		[]string{"BITPOS", "a", "0", "0", "0"},
+		[]string{"SETBIT", "b", "8", "1"},
+		[]string{"BITOP", "OR", "c", "a", "b"},
+		[]string{"BITCOUNT", "c"},
+		[]string{"BITCOUNT", "c", "1", "-1"},
+		[]string{"BITCOUNT", "c", "0", "0", "BIT"},
+		[]string{"BITFIELD", "d", "SET", "u8", "#1", "255", "OVERFLOW", "FAIL", "INCRBY", "u8", "8", "1", "GET", "u4", "8"},
+		[]string{"BITFIELD", "d", "GET", "i8", "4000"},
+		[]string{"nope"},
+		[]string{"GETBIT", "a"},
+		[]string{"DEL", "a", "missing"},
+		[]string{"EXISTS", "a", "b"},
+	)
+	want := []string{
+		"+PONG",
+		":0",
+		":1",
+		"-" + errOffset,
+		":1",
+		":0",
+		":1",
+		":7",
+		":0",
+		":0",
+		":128",
+		":2",
+		":1",
+		"-" + errSyntax,
+		"*3 :0 $-1 :15",
+		"-" + errOffset,
+		"-ERR unknown command 'nope'",
+		"-ERR wrong number of arguments for 'getbit' command",
+		":1",
+		":1",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("failed on test case %d: %q", i+1, got[i])
+		}
+	}
+	if !reg.Get("d").Get(8) || reg.Get("d").Count() != 8 {
+		t.Fatalf("failed on test case %d", len(want)+1)
+	}
+	// inline commands
+	go client.Write([]byte("PING\r\n"))
+	if line, _ := r.ReadString('\n'); line != "+PONG\r\n" {
+		t.Fatalf("failed on test case %d", len(want)+2)
+	}
+	// a null array is no command and offsets must not overflow
+	go client.Write([]byte("*-1\r\nPING\r\n"))
+	if line, _ := r.ReadString('\n'); line != "+PONG\r\n" {
+		t.Fatalf("failed on test case %d", len(want)+3)
+	}
+	got = roundTrip(t, client, r,
+		[]string{"BITFIELD", "d", "GET", "u8", "#9223372036854775807"},
+		[]string{"PING"},
+	)
+	if got[0] != "-"+errOffset || got[1] != "+PONG" {
+		t.Fatalf("failed on test case %d", len(want)+4)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	srv := New(goba.NewRegistry(64))
+	defer srv.Close()
+	for i, req := range []string{
+		"*1\r\n$" + strconv.Itoa(maxBulkLen+1) + "\r\n",
+		strings.Repeat("x", maxLineLen+1) + "\r\n",
+		"*" + strconv.Itoa(maxArgs+1) + "\r\n",
+	} {
+		client, conn := net.Pipe()
+		go srv.ServeConn(conn)
+		go client.Write([]byte(req))
+		r := bufio.NewReader(client)
+		if line, _ := r.ReadString('\n'); line != "-ERR Protocol error\r\n" {
+			t.Fatalf("failed on test case %d: %q", i+1, line)
+		}
+		client.Close()
+	}
+
+	// a large argument arrives in pieces
+	client, conn := net.Pipe()
+	go srv.ServeConn(conn)
+	defer client.Close()
+	arg := strings.Repeat("a", 3*bulkReadLen+5)
+	if got := roundTrip(t, client, bufio.NewReader(client), []string{"PING", arg}); got[0] != "$"+strconv.Itoa(len(arg)) {
+		t.Fatalf("failed on test case 4")
+	}
+}
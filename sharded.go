@@ -0,0 +1,268 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "sync"
+
+// ShardedBitArray splits indices across independently locked shards.
+//
+// Shard i holds a contiguous range of indices in its own BitArray, so
+// writers of different ranges contend neither for a lock nor for the cache
+// lines of bounds and words. Count, iteration and set algebra merge the
+// shards, locking one at a time: they see every shard consistent but not
+// all of them at the same instant. It is safe for concurrent usage.
+type ShardedBitArray struct {
+	length int
+	words  int // words per shard
+	extra  int // leading shards holding one more word
+	shards []bitShard
+}
+
+type bitShard struct {
+	mu sync.RWMutex
+	ba *BitArray
+	_  [32]byte // keeps locks of neighbouring shards on separate cache lines
+}
+
+// NewShardedBitArray returns an instantiated ShardedBitArray of length
+// bits split across n shards, at least 1. Shards hold whole words and
+// differ by at most one word, so n is lowered to the number of words when
+// it exceeds it.
+func NewShardedBitArray(length, n int) *ShardedBitArray {
+	if length < 0 {
+		length = 0
+	}
+	words := (length + 63) >> 6
+	if n > words {
+		n = words
+	}
+	if n < 1 {
+		n = 1
+	}
+	res := ShardedBitArray{length: length, words: words / n, extra: words % n}
+	res.shards = make([]bitShard, n)
+	for i := range res.shards {
+		from, to := res.ShardRange(i)
+		res.shards[i].ba = New(to-from, false)
+	}
+	return &res
+}
+
+// Len returns length in bits
+func (s *ShardedBitArray) Len() int {
+	return s.length
+}
+
+// Shards returns the number of shards
+func (s *ShardedBitArray) Shards() int {
+	return len(s.shards)
+}
+
+// shard returns the shard of index and index within it, or nil
+func (s *ShardedBitArray) shard(index int) (*bitShard, int) {
+	if index < 0 || index >= s.length {
+		return nil, 0
+	}
+	n := s.shardOf(index)
+	return &s.shards[n], index - s.base(n)
+}
+
+// shardOf returns the shard holding index in [0, length)
+func (s *ShardedBitArray) shardOf(index int) int {
+	w, wide := index>>6, s.extra*(s.words+1)
+	if w < wide {
+		return w / (s.words + 1)
+	}
+	return s.extra + (w-wide)/s.words
+}
+
+// base returns the first index of shard n
+func (s *ShardedBitArray) base(n int) int {
+	if n > s.extra {
+		return (n*s.words + s.extra) << 6
+	}
+	return n * (s.words + 1) << 6
+}
+
+// Set sets bit at index
+func (s *ShardedBitArray) Set(index int) {
+	if sh, i := s.shard(index); sh != nil {
+		sh.mu.Lock()
+		sh.ba.Set(i)
+		sh.mu.Unlock()
+	}
+}
+
+// SetChanged sets bit at index and reports whether it changed from 0 to 1
+func (s *ShardedBitArray) SetChanged(index int) bool {
+	sh, i := s.shard(index)
+	if sh == nil {
+		return false
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.ba.SetChanged(i)
+}
+
+// Remove removes bit at index
+func (s *ShardedBitArray) Remove(index int) {
+	if sh, i := s.shard(index); sh != nil {
+		sh.mu.Lock()
+		sh.ba.Remove(i)
+		sh.mu.Unlock()
+	}
+}
+
+// ShardRange returns indices [from, to) held by shard n
+func (s *ShardedBitArray) ShardRange(n int) (from, to int) {
+	from, to = s.base(n), s.base(n+1)
+	if to > s.length {
+		to = s.length
+	}
+	if from > to {
+		from = to
+	}
+	return from, to
+}
+
+// UpdateShard calls fn with BitArray of shard n under its write lock,
+// bit i of it is index base+i. Readers see either none or all of the
+// writes of fn. fn must not keep BitArray after returning.
+func (s *ShardedBitArray) UpdateShard(n int, fn func(ba *BitArray, base int)) {
+	if n < 0 || n >= len(s.shards) {
+		return
+	}
+	sh := &s.shards[n]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	fn(sh.ba, s.base(n))
+}
+
+// SetRange sets bits [from, to) clamped to length, shards of the range
+// are locked together so readers never see it partly set
+func (s *ShardedBitArray) SetRange(from, to int) {
+	s.applyRange(from, to, (*BitArray).SetRange)
+}
+
+// RemoveRange removes bits [from, to) clamped to length, shards of the
+// range are locked together so readers never see it partly removed
+func (s *ShardedBitArray) RemoveRange(from, to int) {
+	s.applyRange(from, to, (*BitArray).RemoveRange)
+}
+
+// applyRange write locks shards of [from, to) in ascending order, which
+// keeps it free of deadlocks with other ranges, and applies op to each
+func (s *ShardedBitArray) applyRange(from, to int, op func(ba *BitArray, from, to int)) {
+	if from < 0 {
+		from = 0
+	}
+	if to > s.length {
+		to = s.length
+	}
+	if from >= to {
+		return
+	}
+	first, last := s.shardOf(from), s.shardOf(to-1)
+	for n := first; n <= last; n++ {
+		s.shards[n].mu.Lock()
+	}
+	for n := first; n <= last; n++ {
+		base := s.base(n)
+		op(s.shards[n].ba, from-base, to-base)
+	}
+	for n := first; n <= last; n++ {
+		s.shards[n].mu.Unlock()
+	}
+}
+
+// Get returns bit value at index
+func (s *ShardedBitArray) Get(index int) bool {
+	sh, i := s.shard(index)
+	if sh == nil {
+		return false
+	}
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return sh.ba.Get(i)
+}
+
+// Count returns count of set bits across shards
+func (s *ShardedBitArray) Count() int {
+	var cnt int
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		cnt += sh.ba.Count()
+		sh.mu.RUnlock()
+	}
+	return cnt
+}
+
+// ForEach calls fn for set bits in ascending order until it returns false.
+// Each shard is read locked while its bits are visited, so fn must not
+// write to ShardedBitArray.
+func (s *ShardedBitArray) ForEach(fn func(index int) bool) {
+	for n := range s.shards {
+		sh := &s.shards[n]
+		base := s.base(n)
+		sh.mu.RLock()
+		for i := sh.ba.nextSet(0); i >= 0; i = sh.ba.nextSet(i + 1) {
+			if !fn(base + i) {
+				sh.mu.RUnlock()
+				return
+			}
+		}
+		sh.mu.RUnlock()
+	}
+}
+
+// BitArray returns a merged copy of shards
+func (s *ShardedBitArray) BitArray() *BitArray {
+	res := New(s.length, false)
+	for n := range s.shards {
+		sh := &s.shards[n]
+		sh.mu.RLock()
+		copy(res.data[s.base(n)>>6:], sh.ba.data)
+		sh.mu.RUnlock()
+	}
+	res.right = int64(res.lastIndex() >> 6)
+	if res.right < 0 {
+		res.right = 0
+	}
+	return res
+}
+
+// Or sets bits of ba, both must have the same length and shards
+func (s *ShardedBitArray) Or(ba *ShardedBitArray) error {
+	return s.combine(ba, func(a, b uint64) uint64 { return a | b })
+}
+
+// And clears bits not set in ba, both must have the same length and shards
+func (s *ShardedBitArray) And(ba *ShardedBitArray) error {
+	return s.combine(ba, func(a, b uint64) uint64 { return a & b })
+}
+
+// AndNot clears bits set in ba, both must have the same length and shards
+func (s *ShardedBitArray) AndNot(ba *ShardedBitArray) error {
+	return s.combine(ba, func(a, b uint64) uint64 { return a &^ b })
+}
+
+// combine applies op shard by shard, shards of ba are copied before
+// locking the ones of s so that no two locks are held at once
+func (s *ShardedBitArray) combine(ba *ShardedBitArray, op func(a, b uint64) uint64) error {
+	if s.length != ba.length || len(s.shards) != len(ba.shards) {
+		return ErrLengthMismatch
+	}
+	for n := range s.shards {
+		src := &ba.shards[n]
+		src.mu.RLock()
+		other := src.ba.Clone()
+		src.mu.RUnlock()
+
+		dst := &s.shards[n]
+		dst.mu.Lock()
+		dst.ba.combineFrom(other, op)
+		dst.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestShardedBitArray(t *testing.T) {
+	s := NewShardedBitArray(1000, 3)
+	if s.Len() != 1000 || s.Shards() != 3 {
+		t.Fatalf("failed on test case 1")
+	}
+	want := []int{0, 5, 383, 384, 700, 767, 768, 999}
+	for _, i := range want {
+		s.Set(i)
+	}
+	s.Set(1000)
+	s.Set(-1)
+	if s.Count() != len(want) || !s.Get(384) || s.Get(385) || s.SetChanged(700) || !s.SetChanged(701) {
+		t.Fatalf("failed on test case 2")
+	}
+	s.Remove(701)
+
+	var got []int
+	s.ForEach(func(i int) bool {
+		got = append(got, i)
+		return true
+	})
+	if len(got) != len(want) {
+		t.Fatalf("failed on test case 3")
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("failed on test case 3")
+		}
+	}
+	var n int
+	s.ForEach(func(i int) bool {
+		n++
+		return i < 384
+	})
+	if n != 4 {
+		t.Fatalf("failed on test case 4")
+	}
+
+	ba := s.BitArray()
+	if ba.Len() != 1000 || ba.Count() != len(want) || !ba.Get(999) || !ba.Get(768) {
+		t.Fatalf("failed on test case 5")
+	}
+
+	o := NewShardedBitArray(1000, 3)
+	o.Set(5)
+	o.Set(6)
+	o.Set(999)
+	x := NewShardedBitArray(1000, 3)
+	x.Or(s)
+	if x.And(o) != nil || x.Count() != 2 || !x.Get(5) || !x.Get(999) {
+		t.Fatalf("failed on test case 6")
+	}
+	if s.AndNot(o) != nil || s.Count() != len(want)-2 || s.Or(o) != nil || s.Count() != len(want)+1 {
+		t.Fatalf("failed on test case 7")
+	}
+	if err := s.Or(NewShardedBitArray(1000, 4)); !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("failed on test case 8")
+	}
+
+	if z := NewShardedBitArray(0, 4); z.Shards() != 1 || z.Count() != 0 || z.BitArray().Len() != 0 {
+		t.Fatalf("failed on test case 9")
+	}
+}
+
+func TestShardedBitArrayConcurrent(t *testing.T) {
+	s := NewShardedBitArray(1<<16, 8)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < s.Len(); i += 8 {
+				s.Set(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if s.Count() != 1<<16 {
+		t.Fatalf("failed on test case 1")
+	}
+}
+
+func TestShardedBitArrayRanges(t *testing.T) {
+	s := NewShardedBitArray(1000, 4)
+	if from, to := s.ShardRange(3); from != 768 || to != 1000 {
+		t.Fatalf("failed on test case 1")
+	}
+	s.SetRange(-5, 2000)
+	if s.Count() != 1000 {
+		t.Fatalf("failed on test case 2")
+	}
+	s.RemoveRange(200, 800)
+	if s.Count() != 400 || !s.Get(199) || s.Get(200) || s.Get(799) || !s.Get(800) {
+		t.Fatalf("failed on test case 3")
+	}
+	s.UpdateShard(1, func(ba *BitArray, base int) {
+		ba.Set(300 - base)
+		ba.Set(301 - base)
+	})
+	s.UpdateShard(9, func(ba *BitArray, base int) {
+		t.Fatalf("failed on test case 4")
+	})
+	if s.Count() != 402 || !s.Get(300) || !s.Get(301) {
+		t.Fatalf("failed on test case 5")
+	}
+
+	// shards differ by at most one word
+	s = NewShardedBitArray(1000, 5)
+	bounds := []int{0, 256, 448, 640, 832, 1000}
+	if s.Shards() != 5 {
+		t.Fatalf("failed on test case 6")
+	}
+	for n := 0; n < 5; n++ {
+		if from, to := s.ShardRange(n); from != bounds[n] || to != bounds[n+1] {
+			t.Fatalf("failed on test case 6")
+		}
+	}
+	s.SetRange(250, 840)
+	if s.Count() != 590 || s.Get(249) || !s.Get(448) || !s.Get(839) || s.Get(840) {
+		t.Fatalf("failed on test case 7")
+	}
+	var got int
+	s.ForEach(func(i int) bool {
+		if i != 250+got {
+			t.Fatalf("failed on test case 8")
+		}
+		got++
+		return true
+	})
+	if got != 590 || s.BitArray().CountRange(250, 840) != 590 {
+		t.Fatalf("failed on test case 8")
+	}
+	// fewer words than shards
+	if NewShardedBitArray(100, 4).Shards() != 2 || NewShardedBitArray(0, 4).Shards() != 1 {
+		t.Fatalf("failed on test case 9")
+	}
+}
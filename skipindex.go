@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "math/bits"
+
+// EnableSkipIndex starts maintaining an index of nonzero words, one bit per
+// word, so searches for set bits in sparse arrays skip 64 empty words per
+// probe. Writes pay for updating the index. It must not be called
+// concurrently with writers.
+func (s *BitArray) EnableSkipIndex() {
+	idx := New(len(s.data), s.concurrent)
+	for i := range s.data {
+		if s.word(i) != 0 {
+			idx.Set(i)
+		}
+	}
+	s.skip = idx
+}
+
+// DisableSkipIndex stops maintaining the index of nonzero words.
+// It must not be called concurrently with writers.
+func (s *BitArray) DisableSkipIndex() {
+	s.skip = nil
+}
+
+// markSkip updates the index for words [lo, hi]. The index may mark zero
+// words but never misses nonzero ones: a cleared mark is restored when a
+// concurrent writer made the word nonzero meanwhile.
+func (s *BitArray) markSkip(lo, hi int64) {
+	if int(hi) >= s.skip.Len() {
+		// data was reallocated
+		s.skip.grow(len(s.data))
+	}
+	for i := int(lo); i <= int(hi); i++ {
+		if s.word(i) != 0 {
+			s.skip.SetChanged(i)
+		} else if s.skip.RemoveChanged(i) && s.word(i) != 0 {
+			s.skip.SetChanged(i)
+		}
+	}
+}
+
+// nextSetIndexed returns index of the first set bit in words from word i
+// on, found with the index, or -1
+func (s *BitArray) nextSetIndexed(i int) int {
+	last := s.lastWord()
+	for j := s.skip.nextSet(i); j >= 0 && j <= last; j = s.skip.nextSet(j + 1) {
+		if v := s.word(j); v != 0 {
+			return j<<6 + bits.TrailingZeros64(v)
+		}
+	}
+	return -1
+}
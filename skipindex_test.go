@@ -0,0 +1,48 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "testing"
+
+func TestSkipIndex(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		s := New(1<<20, concurrent)
+		s.Set(5)
+		s.EnableSkipIndex()
+		s.Set(500000)
+		s.Set(900000)
+		if s.nextSet(0) != 5 || s.nextSet(6) != 500000 || s.nextSet(500001) != 900000 || s.nextSet(900001) != -1 {
+			t.Fatalf("failed on test case 1")
+		}
+		s.Remove(500000)
+		if s.nextSet(6) != 900000 || s.skip.Count() != 2 {
+			t.Fatalf("failed on test case 2")
+		}
+		s.RemoveAll()
+		if s.nextSet(0) != -1 || s.skip.Count() != 0 {
+			t.Fatalf("failed on test case 3")
+		}
+		if !concurrent {
+			s.MergeFrom(New(1<<21, false))
+			s.Set(1<<21 - 1)
+			if s.nextSet(0) != 1<<21-1 {
+				t.Fatalf("failed on test case 4")
+			}
+		}
+		s.DisableSkipIndex()
+		s.Set(7)
+		if s.nextSet(0) != 7 {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+}
+
+func BenchmarkNextSetSkipIndex(b *testing.B) {
+	s := New(1<<26, false)
+	s.Set(1<<26 - 1)
+	s.EnableSkipIndex()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.nextSet(0)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type tracer struct {
+	logger    *slog.Logger
+	threshold time.Duration
+}
+
+// SetTracer enables logging of whole array operations (SetAll, RemoveAll,
+// Count, UnifyWith, IntersectWith, HasIntersectionWith) taking at least
+// threshold. Records hold the duration, sizes and cardinalities involved.
+// A nil logger disables tracing.
+//
+// Not safe for concurrent usage, set it up before sharing BitArray
+func (s *BitArray) SetTracer(logger *slog.Logger, threshold time.Duration) {
+	if s == nil {
+		return
+	}
+	if logger == nil {
+		s.tracer = nil
+		return
+	}
+	s.tracer = &tracer{logger: logger, threshold: threshold}
+}
+
+// trace logs op started at start if it was slow,
+// attrs are only evaluated for logged operations
+func (t *tracer) trace(op string, start time.Time, s *BitArray, attrs func() []slog.Attr) {
+	d := time.Since(start)
+	if d < t.threshold || !t.logger.Enabled(context.Background(), slog.LevelInfo) {
+		return
+	}
+	rec := []slog.Attr{
+		slog.String("op", op),
+		slog.Duration("duration", d),
+		slog.Int("length", s.Len()),
+		slog.Int("words", len(s.data)),
+	}
+	if attrs != nil {
+		rec = append(rec, attrs()...)
+	}
+	t.logger.LogAttrs(context.Background(), slog.LevelInfo, "goba: slow operation", rec...)
+}
+
+// traceLen returns length of ba for attributes, -1 for nil
+func traceLen(ba *BitArray) int {
+	if ba == nil {
+		return -1
+	}
+	return ba.Len()
+}
+
+// traceCount returns count of set bits of ba for attributes, -1 for nil
+func traceCount(ba *BitArray) int {
+	if ba == nil {
+		return -1
+	}
+	return ba.Count()
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBitArrayTracer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	ba := New(1000, false)
+	ba.SetTracer(logger, 0)
+	ba.Set(3)
+	ba.Set(700)
+	ba.Count()
+	t.Log(buf.String())
+
+	if !strings.Contains(buf.String(), "op=Count") || !strings.Contains(buf.String(), "count=2") {
+		t.Fatalf("failed on test case 1")
+	}
+
+	buf.Reset()
+	ba.IntersectWith(New(500, false))
+	if !strings.Contains(buf.String(), "op=IntersectWith") ||
+		!strings.Contains(buf.String(), "other_length=500") {
+		t.Fatalf("failed on test case 2")
+	}
+
+	buf.Reset()
+	ba.SetTracer(logger, time.Hour)
+	ba.SetAll()
+	if buf.Len() != 0 {
+		t.Fatalf("failed on test case 3")
+	}
+
+	ba.SetTracer(nil, 0)
+	ba.RemoveAll()
+	if buf.Len() != 0 {
+		t.Fatalf("failed on test case 4")
+	}
+}
+
+func TestBitArrayTracerNilOther(t *testing.T) {
+	var buf bytes.Buffer
+	ba := New(100, false)
+	ba.SetTracer(slog.New(slog.NewTextHandler(&buf, nil)), 0)
+	if ba.IntersectWith(nil) != nil || ba.HasIntersectionWith(nil) || ba.DifferenceWith(nil) != nil {
+		t.Fatalf("failed on test case 1")
+	}
+	ba.IntersectInPlace(nil)
+	if !strings.Contains(buf.String(), "other_length=-1") || strings.Count(buf.String(), "op=IntersectInPlace") != 1 {
+		t.Fatalf("failed on test case 2")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker keeps one BitArray of active users per period, a day or an hour
+// for instance, and answers activity and retention queries with unions and
+// intersections of period bitmaps. It is safe for concurrent usage.
+type Tracker struct {
+	mu      sync.RWMutex
+	users   int
+	period  time.Duration
+	periods map[int64]*BitArray
+}
+
+// NewTracker returns an instantiated Tracker for users [0, users)
+// with periods of the given duration counted from the Unix epoch
+func NewTracker(users int, period time.Duration) *Tracker {
+	if period <= 0 {
+		period = 24 * time.Hour
+	}
+	return &Tracker{
+		users:   users,
+		period:  period,
+		periods: make(map[int64]*BitArray),
+	}
+}
+
+// Period returns number of the period containing t
+func (tr *Tracker) Period(t time.Time) int64 {
+	n := t.UnixNano()
+	p := n / int64(tr.period)
+	if n < 0 && n%int64(tr.period) != 0 {
+		p--
+	}
+	return p
+}
+
+// Mark records activity of user at t
+func (tr *Tracker) Mark(user int, t time.Time) {
+	tr.MarkPeriod(user, tr.Period(t))
+}
+
+// MarkPeriod records activity of user in period p
+func (tr *Tracker) MarkPeriod(user int, p int64) {
+	tr.mu.RLock()
+	ba := tr.periods[p]
+	tr.mu.RUnlock()
+	if ba == nil {
+		tr.mu.Lock()
+		if ba = tr.periods[p]; ba == nil {
+			ba = New(tr.users, true)
+			tr.periods[p] = ba
+		}
+		tr.mu.Unlock()
+	}
+	ba.Set(user)
+}
+
+// Active returns a copy of users active in period p
+func (tr *Tracker) Active(p int64) *BitArray {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	if ba := tr.periods[p]; ba != nil {
+		return ba.Clone()
+	}
+	return New(tr.users, true)
+}
+
+// ActiveInAnyOf returns users active in at least one of periods
+func (tr *Tracker) ActiveInAnyOf(periods ...int64) *BitArray {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	res := New(tr.users, true)
+	for _, p := range periods {
+		if ba := tr.periods[p]; ba != nil {
+			res.orFrom(ba)
+		}
+	}
+	return res
+}
+
+// ActiveInAllOf returns users active in every one of periods,
+// no periods yield no users
+func (tr *Tracker) ActiveInAllOf(periods ...int64) *BitArray {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	if len(periods) == 0 {
+		return New(tr.users, true)
+	}
+	var res *BitArray
+	for _, p := range periods {
+		ba := tr.periods[p]
+		if ba == nil {
+			return New(tr.users, true)
+		}
+		if res == nil {
+			res = ba.Clone()
+		} else {
+			res = res.IntersectWith(ba)
+		}
+	}
+	return res
+}
+
+// Retention returns a retention matrix for n cohorts starting from
+// period first: cell [i][j] is count of users active both in period
+// first+i and in period first+i+j, rows are truncated at period first+n-1.
+// It returns nil if n <= 0.
+func (tr *Tracker) Retention(first int64, n int) [][]int {
+	if n <= 0 {
+		return nil
+	}
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	res := make([][]int, n)
+	for i := range res {
+		res[i] = make([]int, n-i)
+		cohort := tr.periods[first+int64(i)]
+		if cohort == nil {
+			continue
+		}
+		for j := range res[i] {
+			if ba := tr.periods[first+int64(i+j)]; ba != nil {
+				res[i][j] = cohort.CountAnd(ba)
+			}
+		}
+	}
+	return res
+}
+
+// Forget drops bitmaps of periods before the given one to bound memory usage
+func (tr *Tracker) Forget(before int64) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for p := range tr.periods {
+		if p < before {
+			delete(tr.periods, p)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(100, 24*time.Hour)
+	day := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	d0 := tr.Period(day)
+	if tr.Period(day.Add(11*time.Hour)) != d0 || tr.Period(day.Add(12*time.Hour)) != d0+1 {
+		t.Fatalf("failed on test case 1")
+	}
+	for _, u := range []int{1, 2, 3, 4} {
+		tr.Mark(u, day)
+	}
+	for _, u := range []int{2, 3, 5} {
+		tr.MarkPeriod(u, d0+1)
+	}
+	for _, u := range []int{3, 6} {
+		tr.MarkPeriod(u, d0+2)
+	}
+	if tr.Active(d0).Count() != 4 || tr.Active(d0+5).Count() != 0 {
+		t.Fatalf("failed on test case 2")
+	}
+	if tr.ActiveInAnyOf(d0, d0+1, d0+2).Count() != 6 {
+		t.Fatalf("failed on test case 3")
+	}
+	all := tr.ActiveInAllOf(d0, d0+1, d0+2)
+	if all.Count() != 1 || !all.Get(3) {
+		t.Fatalf("failed on test case 4")
+	}
+	if tr.ActiveInAllOf(d0, d0+7).Count() != 0 || tr.ActiveInAllOf().Count() != 0 {
+		t.Fatalf("failed on test case 5")
+	}
+	m := tr.Retention(d0, 3)
+	if len(m) != 3 || len(m[0]) != 3 || len(m[2]) != 1 ||
+		m[0][0] != 4 || m[0][1] != 2 || m[0][2] != 1 ||
+		m[1][0] != 3 || m[1][1] != 1 || m[2][0] != 2 {
+		t.Fatalf("failed on test case 6")
+	}
+	if tr.Retention(d0, 0) != nil || tr.Retention(d0, -1) != nil {
+		t.Fatalf("failed on test case 6")
+	}
+	tr.Forget(d0 + 1)
+	if tr.Active(d0).Count() != 0 || tr.Active(d0+1).Count() != 3 {
+		t.Fatalf("failed on test case 7")
+	}
+}
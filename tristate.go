@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "math/bits"
+
+// TriState is a value of Kleene three-valued logic
+type TriState uint8
+
+const (
+	TriUnknown TriState = iota
+	TriFalse
+	TriTrue
+)
+
+func (v TriState) String() string {
+	switch v {
+	case TriFalse:
+		return "false"
+	case TriTrue:
+		return "true"
+	}
+	return "unknown"
+}
+
+// Two bits per position: the low one is set for known values and the
+// high one for true, so unknown is 00, false is 01 and true is 11.
+const triLow = 0x5555555555555555
+
+var triCodes = [...]uint64{TriUnknown: 0, TriFalse: 1, TriTrue: 3}
+
+// TriStateArray is an array of TriState values stored in 2 bits each
+type TriStateArray struct {
+	ba *BitArray
+}
+
+// NewTriStateArray returns an instantiated TriStateArray of length
+// TriUnknown values, concurrent for concurrent safe usage
+func NewTriStateArray(length int, concurrent bool) *TriStateArray {
+	return &TriStateArray{ba: New(2*length, concurrent)}
+}
+
+// Len returns count of values
+func (t *TriStateArray) Len() int {
+	return t.ba.Len() / 2
+}
+
+// Get returns value at index, TriUnknown out of range
+func (t *TriStateArray) Get(index int) TriState {
+	if index < 0 || index >= t.Len() {
+		return TriUnknown
+	}
+	switch t.ba.bitsAt(2*index, 2) {
+	case 1:
+		return TriFalse
+	case 3:
+		return TriTrue
+	}
+	return TriUnknown
+}
+
+// Set stores value at index, atomically in concurrent mode
+func (t *TriStateArray) Set(index int, value TriState) {
+	if index < 0 || index >= t.Len() || value > TriTrue {
+		return
+	}
+	t.ba.putBits(2*index, 2, triCodes[value])
+}
+
+// Count returns count of positions holding value
+func (t *TriStateArray) Count(value TriState) int {
+	var cnt int
+	for i := range t.ba.data {
+		w := t.ba.word(i)
+		known, truth := w&triLow, w>>1&triLow
+		switch value {
+		case TriTrue:
+			cnt += bits.OnesCount64(truth)
+		case TriFalse:
+			cnt += bits.OnesCount64(known &^ truth)
+		default:
+			cnt += 32 - bits.OnesCount64(known)
+		}
+	}
+	if value == TriUnknown {
+		// lanes past the length read as unknown
+		cnt -= len(t.ba.data)*32 - t.Len()
+	}
+	return cnt
+}
+
+// And returns Kleene conjunction of both arrays: false if either is false,
+// true if both are true and unknown otherwise
+func (t *TriStateArray) And(o *TriStateArray) (*TriStateArray, error) {
+	return t.combine(o, func(ta, fa, tb, fb uint64) (uint64, uint64) {
+		return ta & tb, fa | fb
+	})
+}
+
+// Or returns Kleene disjunction of both arrays: true if either is true,
+// false if both are false and unknown otherwise
+func (t *TriStateArray) Or(o *TriStateArray) (*TriStateArray, error) {
+	return t.combine(o, func(ta, fa, tb, fb uint64) (uint64, uint64) {
+		return ta | tb, fa & fb
+	})
+}
+
+// Not returns Kleene negation of the array, unknown stays unknown
+func (t *TriStateArray) Not() *TriStateArray {
+	res, _ := t.combine(t, func(ta, fa, _, _ uint64) (uint64, uint64) {
+		return fa, ta
+	})
+	return res
+}
+
+// combine applies op to true and false lanes of each pair of words
+func (t *TriStateArray) combine(o *TriStateArray, op func(ta, fa, tb, fb uint64) (uint64, uint64)) (*TriStateArray, error) {
+	if t.Len() != o.Len() {
+		return nil, ErrLengthMismatch
+	}
+	res := NewTriStateArray(t.Len(), t.ba.concurrent)
+	for i := range res.ba.data {
+		a, b := t.ba.word(i), o.ba.word(i)
+		ta, tb := a>>1&triLow, b>>1&triLow
+		fa, fb := a&triLow&^ta, b&triLow&^tb
+		tr, fr := op(ta, fa, tb, fb)
+		res.ba.data[i] = tr | fr | tr<<1
+	}
+	res.ba.right = int64(len(res.ba.data)) - 1
+	if res.ba.right < 0 {
+		res.ba.right = 0
+	}
+	return res, nil
+}
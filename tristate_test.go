@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTriStateArray(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		a, b := NewTriStateArray(9, concurrent), NewTriStateArray(9, concurrent)
+		values := []TriState{TriUnknown, TriFalse, TriTrue}
+		// all nine pairs
+		for i := 0; i < 9; i++ {
+			a.Set(i, values[i/3])
+			b.Set(i, values[i%3])
+		}
+		if a.Len() != 9 || a.Get(3) != TriFalse || a.Get(8) != TriTrue || a.Get(9) != TriUnknown {
+			t.Fatalf("failed on test case 1")
+		}
+		and, _ := a.And(b)
+		or, _ := a.Or(b)
+		not := a.Not()
+		wantAnd := []TriState{TriUnknown, TriFalse, TriUnknown, TriFalse, TriFalse, TriFalse, TriUnknown, TriFalse, TriTrue}
+		wantOr := []TriState{TriUnknown, TriUnknown, TriTrue, TriUnknown, TriFalse, TriTrue, TriTrue, TriTrue, TriTrue}
+		for i := 0; i < 9; i++ {
+			if and.Get(i) != wantAnd[i] || or.Get(i) != wantOr[i] {
+				t.Fatalf("failed on test case 2")
+			}
+		}
+		if not.Get(0) != TriUnknown || not.Get(3) != TriTrue || not.Get(6) != TriFalse {
+			t.Fatalf("failed on test case 3")
+		}
+		if a.Count(TriUnknown) != 3 || a.Count(TriFalse) != 3 || a.Count(TriTrue) != 3 || and.Count(TriFalse) != 5 {
+			t.Fatalf("failed on test case 4")
+		}
+		a.Set(8, TriUnknown)
+		if a.Get(8) != TriUnknown || a.Count(TriUnknown) != 4 {
+			t.Fatalf("failed on test case 5")
+		}
+		if _, err := a.And(NewTriStateArray(8, concurrent)); !errors.Is(err, ErrLengthMismatch) {
+			t.Fatalf("failed on test case 6")
+		}
+	}
+}
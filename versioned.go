@@ -0,0 +1,177 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import "sync"
+
+// VersionedBitArray is a BitArray whose committed versions stay queryable.
+//
+// Every Commit seals mutations since the previous one as a new version,
+// stored as a delta of the modified words. Every snapshotEvery versions a
+// full copy is kept too, so a past version is rebuilt from the nearest
+// snapshot and a bounded number of deltas. Only the last retain snapshots
+// and the deltas after the oldest of them are kept. It is safe for
+// concurrent usage.
+type VersionedBitArray struct {
+	mu            sync.RWMutex
+	cur           *BitArray
+	version       uint64
+	snapshotEvery int
+	retain        int
+	snapshots     []versionSnapshot
+	deltas        []versionDelta
+}
+
+type versionSnapshot struct {
+	version uint64
+	ba      *BitArray
+}
+
+// versionDelta holds words [offset, offset+len(words)) of a version
+type versionDelta struct {
+	version uint64
+	offset  int
+	words   []uint64
+}
+
+// NewVersionedBitArray returns an instantiated VersionedBitArray of length
+// bits at version 0, with a snapshot every snapshotEvery versions and the
+// last retain snapshots kept, both at least 1
+func NewVersionedBitArray(length, snapshotEvery, retain int) *VersionedBitArray {
+	if snapshotEvery < 1 {
+		snapshotEvery = 1
+	}
+	if retain < 1 {
+		retain = 1
+	}
+	cur := New(length, true)
+	cur.TrackDirty(1)
+	return &VersionedBitArray{
+		cur:           cur,
+		snapshotEvery: snapshotEvery,
+		retain:        retain,
+		snapshots:     []versionSnapshot{{0, New(length, false)}},
+	}
+}
+
+// Set sets bit at index in the current, uncommitted state
+func (v *VersionedBitArray) Set(index int) {
+	v.mu.RLock()
+	v.cur.Set(index)
+	v.mu.RUnlock()
+}
+
+// Remove removes bit at index in the current, uncommitted state
+func (v *VersionedBitArray) Remove(index int) {
+	v.mu.RLock()
+	v.cur.Remove(index)
+	v.mu.RUnlock()
+}
+
+// Get returns bit at index of the current, uncommitted state
+func (v *VersionedBitArray) Get(index int) bool {
+	return v.cur.Get(index)
+}
+
+// Version returns the last committed version
+func (v *VersionedBitArray) Version() uint64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.version
+}
+
+// Commit seals mutations since the previous commit as a new version
+// and returns its number
+func (v *VersionedBitArray) Commit() uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.version++
+	for _, r := range v.cur.ClearDirty() {
+		lo, hi := r.Start>>6, (r.End+63)>>6
+		words := make([]uint64, hi-lo)
+		copy(words, v.cur.data[lo:hi])
+		v.deltas = append(v.deltas, versionDelta{v.version, lo, words})
+	}
+	if v.version%uint64(v.snapshotEvery) == 0 {
+		v.snapshots = append(v.snapshots, versionSnapshot{v.version, v.cur.Clone()})
+		if len(v.snapshots) > v.retain {
+			v.snapshots = v.snapshots[len(v.snapshots)-v.retain:]
+			oldest := v.snapshots[0].version
+			n := 0
+			for n < len(v.deltas) && v.deltas[n].version <= oldest {
+				n++
+			}
+			v.deltas = append(v.deltas[:0:0], v.deltas[n:]...)
+		}
+	}
+	return v.version
+}
+
+// base returns the nearest snapshot at or before version and the deltas
+// after it up to version, or ErrVersionUnavailable
+func (v *VersionedBitArray) base(version uint64) (*BitArray, []versionDelta, error) {
+	if version > v.version || version < v.snapshots[0].version {
+		return nil, nil, ErrVersionUnavailable
+	}
+	snap := v.snapshots[0]
+	for _, s := range v.snapshots[1:] {
+		if s.version > version {
+			break
+		}
+		snap = s
+	}
+	lo := 0
+	for lo < len(v.deltas) && v.deltas[lo].version <= snap.version {
+		lo++
+	}
+	hi := lo
+	for hi < len(v.deltas) && v.deltas[hi].version <= version {
+		hi++
+	}
+	return snap.ba, v.deltas[lo:hi], nil
+}
+
+// GetAt returns bit at index as of version
+func (v *VersionedBitArray) GetAt(index int, version uint64) (bool, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	snap, deltas, err := v.base(version)
+	if err != nil {
+		return false, err
+	}
+	w := index >> 6
+	for i := len(deltas) - 1; i >= 0; i-- {
+		if d := deltas[i]; w >= d.offset && w < d.offset+len(d.words) {
+			return d.words[w-d.offset]&(1<<(index&0x3f)) != 0, nil
+		}
+	}
+	return snap.Get(index), nil
+}
+
+// At returns a copy of BitArray as of version
+func (v *VersionedBitArray) At(version uint64) (*BitArray, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	snap, deltas, err := v.base(version)
+	if err != nil {
+		return nil, err
+	}
+	res := snap.Clone()
+	for _, d := range deltas {
+		copy(res.data[d.offset:], d.words)
+	}
+	res.right = int64(res.lastIndex() >> 6)
+	if res.right < 0 {
+		res.right = 0
+	}
+	return res, nil
+}
+
+// CountAt returns count of set bits as of version
+func (v *VersionedBitArray) CountAt(version uint64) (int, error) {
+	ba, err := v.At(version)
+	if err != nil {
+		return 0, err
+	}
+	return ba.Count(), nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVersionedBitArray(t *testing.T) {
+	v := NewVersionedBitArray(1000, 3, 2)
+	// version i sets bit 10*i and removes bit 10*(i-1)
+	for i := 1; i <= 10; i++ {
+		v.Set(10 * i)
+		v.Set(999)
+		v.Remove(10 * (i - 1))
+		if v.Commit() != uint64(i) {
+			t.Fatalf("failed on test case 1")
+		}
+	}
+	v.Set(500)
+	if v.Version() != 10 || !v.Get(500) {
+		t.Fatalf("failed on test case 2")
+	}
+	// snapshots at 6 and 9 are retained
+	for i := 6; i <= 10; i++ {
+		if ok, err := v.GetAt(10*i, uint64(i)); err != nil || !ok {
+			t.Fatalf("failed on test case 3")
+		}
+		if ok, _ := v.GetAt(10*(i-1), uint64(i)); ok {
+			t.Fatalf("failed on test case 4")
+		}
+		if ok, _ := v.GetAt(500, uint64(i)); ok {
+			t.Fatalf("failed on test case 5")
+		}
+		if n, err := v.CountAt(uint64(i)); err != nil || n != 2 {
+			t.Fatalf("failed on test case 6")
+		}
+	}
+	if _, err := v.GetAt(1, 5); !errors.Is(err, ErrVersionUnavailable) {
+		t.Fatalf("failed on test case 7")
+	}
+	if _, err := v.CountAt(11); !errors.Is(err, ErrVersionUnavailable) {
+		t.Fatalf("failed on test case 8")
+	}
+	ba, err := v.At(7)
+	if err != nil || !ba.Get(70) || !ba.Get(999) || ba.Count() != 2 {
+		t.Fatalf("failed on test case 9")
+	}
+	// deltas up to the oldest snapshot are dropped
+	for _, d := range v.deltas {
+		if d.version <= 6 {
+			t.Fatalf("failed on test case 10")
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Nikita Chisnikov <chisnikov@gmail.com>
+// Distributed under the MIT/X11 software license
+package goba
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestXorFilter(t *testing.T) {
+	keys := make([]uint64, 50000)
+	for i := range keys {
+		keys[i] = uint64(i) * 7919
+	}
+	keys = append(keys, keys[:100]...)
+
+	f, err := NewXorFilter(keys)
+	if err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	for _, k := range keys {
+		if !f.Contains(k) {
+			t.Fatalf("failed on test case 2")
+		}
+	}
+
+	var fp int
+	for i := 0; i < 100000; i++ {
+		if f.Contains(uint64(i)*7919 + 1) {
+			fp++
+		}
+	}
+	t.Log(fp, len(f.fingerprints))
+	if fp > 600 {
+		t.Fatalf("failed on test case 3")
+	}
+
+	data, _ := f.MarshalBinary()
+	var g XorFilter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatalf("failed on test case 4: %v", err)
+	}
+	for _, k := range keys[:1000] {
+		if !g.Contains(k) {
+			t.Fatalf("failed on test case 5")
+		}
+	}
+	if err := g.UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 6: %v", err)
+	}
+	data[4] = 2
+	if err := g.UnmarshalBinary(data); !errors.Is(err, ErrFormatVersion) {
+		t.Fatalf("failed on test case 7: %v", err)
+	}
+	// an empty table would make Contains index past it
+	empty := append([]byte(nil), data[:headerSize+12]...)
+	empty[4] = 1
+	binary.LittleEndian.PutUint32(empty[headerSize+8:], 0)
+	if err := g.UnmarshalBinary(empty); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 8: %v", err)
+	}
+	binary.LittleEndian.PutUint32(empty[headerSize+8:], 1)
+	if err := g.UnmarshalBinary(append(empty, 1, 2, 3)); !errors.Is(err, ErrCorruptData) {
+		t.Fatalf("failed on test case 9: %v", err)
+	}
+}
+
+func TestXorFilterEmpty(t *testing.T) {
+	f, err := NewXorFilter(nil)
+	if err != nil {
+		t.Fatalf("failed on test case 1: %v", err)
+	}
+	f, err = NewXorFilter([]uint64{42})
+	if err != nil || !f.Contains(42) {
+		t.Fatalf("failed on test case 2: %v", err)
+	}
+}